@@ -0,0 +1,414 @@
+package httpoh
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// Authenticator adds credentials to requests sent by ClientNative. Wrap is
+// applied to the innermost step of the chain, after all middlewares, so the
+// authenticator sees the request exactly as it goes to the http.Client and
+// may send it again after answering an authentication challenge. Requests
+// already carrying an Authorization header are left alone.
+type Authenticator interface {
+	Wrap(next http.RoundTripper) http.RoundTripper
+}
+
+// BasicAuth sends the username and password with every request.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("Authorization") == "" {
+			r.SetBasicAuth(a.Username, a.Password)
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+// BearerToken sends a static bearer token with every request.
+type BearerToken struct {
+	Token string
+}
+
+func (a BearerToken) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+a.Token)
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+// NTLMAuth negotiates NTLM or Negotiate authentication with the given
+// credentials, falling back to Basic when the server does not ask for NTLM.
+// Username may include the domain as DOMAIN\user.
+type NTLMAuth struct {
+	Username string
+	Password string
+}
+
+func (a NTLMAuth) Wrap(next http.RoundTripper) http.RoundTripper {
+	negotiator := ntlmssp.Negotiator{RoundTripper: next}
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("Authorization") == "" {
+			r.SetBasicAuth(a.Username, a.Password)
+		}
+		return negotiator.RoundTrip(r)
+	})
+}
+
+// OAuth2ClientCredentials obtains access tokens from TokenURL with the OAuth2
+// client credentials grant and sends them as bearer tokens. Tokens are cached
+// until ExpiryDelta (10s by default) before they expire. A 401 response
+// drops the cached token, and the request is sent once more with a new token
+// when its body can be replayed. Token requests go through the same
+// http.Client as the requests being authenticated. Use OAuth2TokenSource for
+// other grants or client authentication in the request body.
+type OAuth2ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	ExpiryDelta  time.Duration
+	Now          func() time.Time
+
+	once   sync.Once
+	source *OAuth2TokenSource
+	err    error
+}
+
+// oauth2TransportKey holds the http.RoundTripper token requests of
+// OAuth2ClientCredentials are sent with.
+type oauth2TransportKey struct{}
+
+func (a *OAuth2ClientCredentials) Wrap(next http.RoundTripper) http.RoundTripper {
+	a.once.Do(a.init)
+	if a.err != nil {
+		return RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+			return nil, a.err
+		})
+	}
+	wrapped := a.source.Wrap(next)
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return wrapped.RoundTrip(r.WithContext(context.WithValue(r.Context(), oauth2TransportKey{}, next)))
+	})
+}
+
+func (a *OAuth2ClientCredentials) init() {
+	transport := RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		next, ok := r.Context().Value(oauth2TransportKey{}).(http.RoundTripper)
+		if !ok {
+			return nil, errors.New("oauth2 client credentials: token request sent outside of Wrap")
+		}
+		return next.RoundTrip(r)
+	})
+	client, err := NewClientNative(Config{}, &http.Client{Transport: transport})
+	if err != nil {
+		a.err = err
+		return
+	}
+	a.source, a.err = NewOAuth2TokenSource(OAuth2Config{
+		TokenURL:     a.TokenURL,
+		ClientID:     a.ClientID,
+		ClientSecret: a.ClientSecret,
+		Scopes:       a.Scopes,
+		ExpirySkew:   a.ExpiryDelta,
+		Now:          a.Now,
+	}, client)
+}
+
+// DigestAuth answers HTTP Digest challenges (RFC 7616) with MD5, SHA-256 and
+// SHA-512-256 algorithms, their -sess variants and qop=auth. The first
+// request to a host is sent without credentials, later ones reuse the last
+// challenge of that host with an increasing nonce count. Requests whose body
+// can not be replayed get the 401 response back when challenged.
+type DigestAuth struct {
+	Username string
+	Password string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+	nc        int
+}
+
+func (a *DigestAuth) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("Authorization") != "" {
+			return next.RoundTrip(r)
+		}
+
+		if authorization, ok := a.authorize(r); ok {
+			r.Header.Set("Authorization", authorization)
+		}
+		resp, err := next.RoundTrip(r)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+
+		challenge, ok := parseDigestChallenge(resp.Header.Values("Www-Authenticate"))
+		if !ok {
+			return resp, nil
+		}
+		a.mu.Lock()
+		if a.challenges == nil {
+			a.challenges = make(map[string]*digestChallenge)
+		}
+		a.challenges[r.URL.Host] = challenge
+		a.mu.Unlock()
+
+		retry, ok := rewindRequest(r)
+		if !ok {
+			return resp, nil
+		}
+		authorization, ok := a.authorize(retry)
+		if !ok {
+			if retry.Body != nil {
+				retry.Body.Close()
+			}
+			return resp, nil
+		}
+		discardBody(resp)
+		retry.Header.Set("Authorization", authorization)
+		return next.RoundTrip(retry)
+	})
+}
+
+func (a *DigestAuth) authorize(r *http.Request) (string, bool) {
+	a.mu.Lock()
+	c, ok := a.challenges[r.URL.Host]
+	if !ok {
+		a.mu.Unlock()
+		return "", false
+	}
+	c.nc++
+	challenge := *c
+	a.mu.Unlock()
+
+	var cnonce [16]byte
+	if _, err := rand.Read(cnonce[:]); err != nil {
+		return "", false
+	}
+	return challenge.authorization(a.Username, a.Password, r.Method, r.URL.RequestURI(), hex.EncodeToString(cnonce[:]))
+}
+
+func (c *digestChallenge) authorization(username, password, method, uri, cnonce string) (string, bool) {
+	newHash, sess, ok := digestAlgorithm(c.algorithm)
+	if !ok {
+		return "", false
+	}
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	nc := fmt.Sprintf("%08x", c.nc)
+	ha1 := h(username + ":" + c.realm + ":" + password)
+	if sess {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	var response string
+	if c.qop != "" {
+		response = h(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	if c.userhash {
+		username = h(username + ":" + c.realm)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username=%q, realm=%q, nonce=%q, uri=%q, response=%q`, username, c.realm, c.nonce, uri, response)
+	if c.algorithm != "" {
+		fmt.Fprintf(&b, ", algorithm=%s", c.algorithm)
+	}
+	if c.opaque != "" {
+		fmt.Fprintf(&b, ", opaque=%q", c.opaque)
+	}
+	if c.qop != "" {
+		fmt.Fprintf(&b, `, qop=%s, nc=%s, cnonce=%q`, c.qop, nc, cnonce)
+	}
+	if c.userhash {
+		b.WriteString(", userhash=true")
+	}
+	return b.String(), true
+}
+
+func digestAlgorithm(name string) (newHash func() hash.Hash, sess bool, ok bool) {
+	base, sess := strings.CutSuffix(strings.ToUpper(name), "-SESS")
+	switch base {
+	case "", "MD5":
+		return md5.New, sess, true
+	case "SHA-256":
+		return sha256.New, sess, true
+	case "SHA-512-256":
+		return sha512.New512_256, sess, true
+	}
+	return nil, false, false
+}
+
+// parseDigestChallenge picks the strongest supported Digest challenge from
+// WWW-Authenticate header values.
+func parseDigestChallenge(values []string) (*digestChallenge, bool) {
+	var best *digestChallenge
+	bestRank := -1
+	for _, value := range values {
+		for _, challenge := range splitChallenges(value) {
+			scheme, params, _ := strings.Cut(challenge, " ")
+			if !strings.EqualFold(scheme, "Digest") {
+				continue
+			}
+			p := parseAuthParams(params)
+			c := &digestChallenge{
+				realm:     p["realm"],
+				nonce:     p["nonce"],
+				opaque:    p["opaque"],
+				algorithm: p["algorithm"],
+				userhash:  strings.EqualFold(p["userhash"], "true"),
+			}
+			if qop, hasQop := p["qop"]; hasQop {
+				if !hasToken(qop, "auth") {
+					continue
+				}
+				c.qop = "auth"
+			}
+			if _, _, ok := digestAlgorithm(c.algorithm); !ok || c.nonce == "" {
+				continue
+			}
+			rank := 0
+			switch base, _ := strings.CutSuffix(strings.ToUpper(c.algorithm), "-SESS"); base {
+			case "SHA-256":
+				rank = 1
+			case "SHA-512-256":
+				rank = 2
+			}
+			if rank > bestRank {
+				best, bestRank = c, rank
+			}
+		}
+	}
+	return best, best != nil
+}
+
+const tokenChars = "!#$%&'*+-.^_`|~0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// splitChallenges splits a WWW-Authenticate value holding several challenges.
+// A new challenge starts at a comma followed by a token that is not followed
+// by "=".
+func splitChallenges(value string) []string {
+	var challenges []string
+	start, inQuotes := 0, false
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if inQuotes {
+				i++
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if inQuotes {
+				continue
+			}
+			rest := strings.TrimLeft(value[i+1:], " \t")
+			token := rest[:len(rest)-len(strings.TrimLeft(rest, tokenChars))]
+			if token != "" && !strings.HasPrefix(strings.TrimLeft(rest[len(token):], " \t"), "=") {
+				challenges = append(challenges, strings.TrimSpace(value[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(challenges, strings.TrimSpace(value[start:]))
+}
+
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, " \t,") {
+		key, rest, found := strings.Cut(s, "=")
+		if !found {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " \t")
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			s = rest[end:]
+		}
+		params[key] = value.String()
+	}
+	return params
+}
+
+func hasToken(list, token string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(item), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// rewindRequest returns a copy of r with a fresh body for sending it again,
+// or false when the body can not be replayed.
+func rewindRequest(r *http.Request) (*http.Request, bool) {
+	retry := r.Clone(r.Context())
+	if r.Body == nil || r.Body == http.NoBody {
+		return retry, true
+	}
+	if r.GetBody == nil {
+		return nil, false
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	retry.Body = body
+	return retry, true
+}
+
+func discardBody(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+}
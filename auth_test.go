@@ -0,0 +1,365 @@
+package httpoh
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func performAuthRequest(t *testing.T, auth Authenticator, req Request) (int, error) {
+	client, newError := NewClientNative(Config{Authenticator: auth}, &http.Client{})
+	require.NoError(t, newError)
+	resp := &testResponse{}
+	err := client.PerformRequest(context.Background(), req, resp)
+	return resp.code, err
+}
+
+func TestBasicAndBearerAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); ok && username == "user" && password == "secret" {
+			return
+		}
+		if r.Header.Get("Authorization") == "Bearer token" {
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		Name       string
+		Auth       Authenticator
+		WantStatus int
+	}{
+		{Name: "basic", Auth: BasicAuth{Username: "user", Password: "secret"}, WantStatus: http.StatusOK},
+		{Name: "basic wrong password", Auth: BasicAuth{Username: "user", Password: "WTF"}, WantStatus: http.StatusUnauthorized},
+		{Name: "bearer", Auth: BearerToken{Token: "token"}, WantStatus: http.StatusOK},
+		{Name: "none", WantStatus: http.StatusUnauthorized},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			code, err := performAuthRequest(t, tc.Auth, testGet(server.URL))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.WantStatus, code)
+		})
+	}
+}
+
+func TestAuthRequestHeaderWins(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	req := NewMockRequestWithHeaders(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodGet)
+	req.EXPECT().Headers().Return(http.Header{"Authorization": []string{"Custom abc"}})
+
+	_, err := performAuthRequest(t, BearerToken{Token: "token"}, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "Custom abc", got)
+}
+
+type oauth2TestServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	issued    int
+	valid     map[string]bool
+	expiresIn int
+	failToken bool
+	requests  []string
+}
+
+func newOAuth2TestServer(t *testing.T) *oauth2TestServer {
+	s := &oauth2TestServer{valid: make(map[string]bool), expiresIn: 3600}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if r.URL.Path == "/token" {
+			clientID, clientSecret, _ := r.BasicAuth()
+			assert.Equal(t, "client", clientID)
+			assert.Equal(t, "secret", clientSecret)
+			assert.Equal(t, "client_credentials", r.PostFormValue("grant_type"))
+			assert.Equal(t, "read write", r.PostFormValue("scope"))
+			w.Header().Set("Content-Type", "application/json")
+			if s.failToken {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_client"}`))
+				return
+			}
+			s.issued++
+			token := fmt.Sprintf("token-%d", s.issued)
+			s.valid[token] = true
+			fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":%d}`, token, s.expiresIn)
+			return
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.requests = append(s.requests, token)
+		if !s.valid[token] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	return s
+}
+
+func (s *oauth2TestServer) revokeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.valid)
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	server := newOAuth2TestServer(t)
+	defer server.Close()
+	clock := newFakeClock()
+	auth := &OAuth2ClientCredentials{
+		TokenURL:     server.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+		Now:          clock.Now,
+	}
+
+	for i := 0; i < 2; i++ {
+		code, err := performAuthRequest(t, auth, testGet(server.URL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, code)
+	}
+	assert.Equal(t, []string{"token-1", "token-1"}, server.requests)
+
+	// refreshed ExpiryDelta before expiration
+	clock.Advance(time.Hour - 5*time.Second)
+	code, err := performAuthRequest(t, auth, testGet(server.URL))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "token-2", server.requests[2])
+
+	// refresh on 401, replayable body is sent again
+	server.revokeAll()
+	server.requests = nil
+	req, newError := NewJSONRequest(http.MethodPost, server.URL, map[string]int{"n": 1})
+	require.NoError(t, newError)
+	resp := &JSONResponse[map[string]int]{}
+	client, newError := NewClientNative(Config{Authenticator: auth, CheckStatus: true}, &http.Client{})
+	require.NoError(t, newError)
+	require.NoError(t, client.PerformRequest(context.Background(), req, resp))
+	assert.Equal(t, map[string]int{"n": 1}, resp.Data)
+	assert.Equal(t, []string{"token-2", "token-3"}, server.requests)
+}
+
+func TestOAuth2ClientCredentialsErrors(t *testing.T) {
+	server := newOAuth2TestServer(t)
+	defer server.Close()
+	auth := &OAuth2ClientCredentials{
+		TokenURL:     server.URL + "/token",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+	}
+
+	server.failToken = true
+	_, err := performAuthRequest(t, auth, testGet(server.URL))
+	assert.ErrorContains(t, err, "oauth2 token: invalid_client")
+	assert.Empty(t, server.requests)
+
+	// the 401 is returned when the body can not be sent again
+	server.failToken = false
+	_, err = performAuthRequest(t, auth, testGet(server.URL))
+	require.NoError(t, err)
+	server.revokeAll()
+	server.requests = nil
+
+	req := NewMockRequestWithBody(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodPost)
+	req.EXPECT().Body().Return(io.MultiReader(strings.NewReader("body")))
+	code, err := performAuthRequest(t, auth, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, []string{"token-1"}, server.requests)
+}
+
+func digestTestHandler(t *testing.T, algorithm, username, password string, authorized *int) http.Handler {
+	const realm, nonce, opaque = "test@example.org", "dcd98b7102dd2f0e8b11d0f600bfb0c093", "5ccc069c403ebaf9f0171e9517f40e41"
+	newHash := md5.New
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, params, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		p := parseAuthParams(params)
+		if scheme == "Digest" && p["nonce"] == nonce && p["opaque"] == opaque && p["uri"] == r.URL.RequestURI() {
+			ha1 := h(username + ":" + realm + ":" + password)
+			if strings.HasSuffix(algorithm, "-sess") {
+				ha1 = h(ha1 + ":" + nonce + ":" + p["cnonce"])
+			}
+			ha2 := h(r.Method + ":" + r.URL.RequestURI())
+			if p["response"] == h(ha1+":"+nonce+":"+p["nc"]+":"+p["cnonce"]+":auth:"+ha2) {
+				*authorized++
+				body, _ := io.ReadAll(r.Body)
+				w.Write(body)
+				return
+			}
+		}
+		w.Header().Add("WWW-Authenticate", `Basic realm="`+realm+`"`)
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm=%q, qop="auth,auth-int", algorithm=%s, nonce=%q, opaque=%q`, realm, algorithm, nonce, opaque))
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
+
+func TestDigestAuth(t *testing.T) {
+	for _, tc := range []struct {
+		Algorithm  string
+		Password   string
+		WantStatus int
+	}{
+		{Algorithm: "MD5", Password: "Circle of Life", WantStatus: http.StatusOK},
+		{Algorithm: "SHA-256", Password: "Circle of Life", WantStatus: http.StatusOK},
+		{Algorithm: "SHA-256-sess", Password: "Circle of Life", WantStatus: http.StatusOK},
+		{Algorithm: "MD5", Password: "WTF", WantStatus: http.StatusUnauthorized},
+	} {
+		t.Run(tc.Algorithm+" "+tc.Password, func(t *testing.T) {
+			authorized := 0
+			server := httptest.NewServer(digestTestHandler(t, tc.Algorithm, "Mufasa", "Circle of Life", &authorized))
+			defer server.Close()
+			auth := &DigestAuth{Username: "Mufasa", Password: tc.Password}
+			client, newError := NewClientNative(Config{Authenticator: auth}, &http.Client{})
+			require.NoError(t, newError)
+
+			for i := 0; i < 2; i++ {
+				req, newError := NewJSONRequest(http.MethodPost, server.URL+"/dir/index.html?q=1", []int{i})
+				require.NoError(t, newError)
+				resp := &testResponse{}
+				require.NoError(t, client.PerformRequest(context.Background(), req, resp))
+				assert.Equal(t, tc.WantStatus, resp.code)
+			}
+			if tc.WantStatus == http.StatusOK {
+				assert.Equal(t, 2, authorized)
+				assert.Equal(t, 2, auth.challenges[strings.TrimPrefix(server.URL, "http://")].nc)
+			}
+		})
+	}
+}
+
+func TestDigestChallengeAuthorization(t *testing.T) {
+	// RFC 7616 section 3.9.1
+	for _, tc := range []struct {
+		Algorithm    string
+		WantResponse string
+	}{
+		{Algorithm: "MD5", WantResponse: "8ca523f5e9506fed4657c9700eebdbec"},
+		{Algorithm: "SHA-256", WantResponse: "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	} {
+		challenge, ok := parseDigestChallenge([]string{
+			`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=` + tc.Algorithm +
+				`, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		})
+		require.True(t, ok)
+		challenge.nc = 1
+		authorization, ok := challenge.authorization("Mufasa", "Circle of Life", http.MethodGet, "/dir/index.html", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+		require.True(t, ok)
+		assert.Contains(t, authorization, `response="`+tc.WantResponse+`"`)
+		assert.Contains(t, authorization, "qop=auth, nc=00000001")
+		assert.Contains(t, authorization, `opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	challenge, ok := parseDigestChallenge([]string{
+		`Basic realm="a, b", Digest realm="r", nonce="n1", algorithm=MD5, Digest realm="r", nonce="n2", algorithm=SHA-256, qop=auth`,
+	})
+	require.True(t, ok)
+	assert.Equal(t, "n2", challenge.nonce)
+	assert.Equal(t, "auth", challenge.qop)
+
+	_, ok = parseDigestChallenge([]string{`Digest realm="r", nonce="n", qop="auth-int"`})
+	assert.False(t, ok)
+	_, ok = parseDigestChallenge([]string{`Digest realm="r", nonce="n", algorithm=SHA-1`})
+	assert.False(t, ok)
+	_, ok = parseDigestChallenge([]string{`Basic realm="r"`})
+	assert.False(t, ok)
+}
+
+func ntlmMessageType(header, scheme string) uint32 {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, scheme+" "))
+	if err != nil || len(data) < 12 || string(data[:8]) != "NTLMSSP\x00" {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(data[8:12])
+}
+
+// ntlmTestChallenge returns a minimal challenge message: no target name,
+// no target info.
+func ntlmTestChallenge() string {
+	challenge := make([]byte, 48)
+	copy(challenge, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(challenge[8:], 2)
+	binary.LittleEndian.PutUint32(challenge[20:], 1)
+	copy(challenge[24:32], "12345678")
+	return "NTLM " + base64.StdEncoding.EncodeToString(challenge)
+}
+
+func TestNTLMAuth(t *testing.T) {
+	var steps []uint32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		step := ntlmMessageType(r.Header.Get("Authorization"), "NTLM")
+		steps = append(steps, step)
+		switch step {
+		case 1:
+			w.Header().Set("WWW-Authenticate", ntlmTestChallenge())
+			w.WriteHeader(http.StatusUnauthorized)
+		case 3:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("WWW-Authenticate", "NTLM")
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	code, err := performAuthRequest(t, NTLMAuth{Username: `DOMAIN\user`, Password: "secret"}, testGet(server.URL))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []uint32{0, 1, 3}, steps)
+}
+
+func TestNTLMAuthBasicFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); ok && username == "user" && password == "secret" {
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	code, err := performAuthRequest(t, NTLMAuth{Username: "user", Password: "secret"}, testGet(server.URL))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,237 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrBatchSkipped = errors.New("batch: skipped after a failure")
+
+// batchReadAhead bounds the items RunChan queues to batchReadAhead times
+// Concurrency.
+const batchReadAhead = 4
+
+type BatchItem struct {
+	Request  Request
+	Response Response
+}
+
+// BatchResult reports the outcome of the item received at Index.
+type BatchResult struct {
+	Index int
+	Item  BatchItem
+	Err   error
+}
+
+// BatchError is returned by BatchExecutor.Run when some items failed. Errors
+// holds the error of each item, nil for successful ones.
+type BatchError struct {
+	Errors []error
+	first  error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("batch: %d of %d requests failed: %v", failed, len(e.Errors), e.first)
+}
+
+func (e *BatchError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+type BatchConfig struct {
+	Concurrency        int
+	PerHostConcurrency int
+	FailFast           bool
+}
+
+// BatchExecutor performs many requests with Client, at most Concurrency (10
+// by default) at once and at most PerHostConcurrency (no limit by default) to
+// a single host. Hosts are served in turn, so a host with many queued
+// requests does not delay the others. With FailFast the first failure cancels
+// requests in flight, and items not started yet fail with ErrBatchSkipped;
+// otherwise all items are performed.
+type BatchExecutor struct {
+	Client             Client
+	Concurrency        int
+	PerHostConcurrency int
+	FailFast           bool
+}
+
+func NewBatchExecutor(cfg BatchConfig, client Client) (*BatchExecutor, error) {
+	if client == nil {
+		return nil, errors.New("batch executor: client is nil")
+	}
+	if cfg.Concurrency < 0 || cfg.PerHostConcurrency < 0 {
+		return nil, fmt.Errorf("batch executor: invalid concurrency %d/%d", cfg.Concurrency, cfg.PerHostConcurrency)
+	}
+	b := &BatchExecutor{
+		Client:             client,
+		Concurrency:        cfg.Concurrency,
+		PerHostConcurrency: cfg.PerHostConcurrency,
+		FailFast:           cfg.FailFast,
+	}
+	if b.Concurrency == 0 {
+		b.Concurrency = 10
+	}
+	return b, nil
+}
+
+// Run performs items and returns a *BatchError when any of them failed.
+func (b *BatchExecutor) Run(ctx context.Context, items []BatchItem) error {
+	results := make(chan BatchResult)
+	go b.schedule(ctx, items, nil, results)
+
+	batchErr := &BatchError{Errors: make([]error, len(items))}
+	for result := range results {
+		batchErr.Errors[result.Index] = result.Err
+		if result.Err != nil && batchErr.first == nil {
+			batchErr.first = result.Err
+		}
+	}
+	if batchErr.first != nil {
+		return batchErr
+	}
+	return nil
+}
+
+// RunChan performs items received from input until it is closed and sends
+// a result for each of them. The result channel is closed when all items are
+// done. Once ctx is done, or a request failed in FailFast mode, items still
+// received fail without being performed. Hosts are served in turn among the
+// items read ahead of those in flight, Concurrency of them, or up to 4 times
+// Concurrency when the queued ones all wait for their host.
+func (b *BatchExecutor) RunChan(ctx context.Context, input <-chan BatchItem) <-chan BatchResult {
+	results := make(chan BatchResult)
+	go b.schedule(ctx, nil, input, results)
+	return results
+}
+
+type batchTask struct {
+	result BatchResult
+	host   string
+}
+
+// schedule performs items along with those received from input, when it is
+// nil.
+func (b *BatchExecutor) schedule(ctx context.Context, items []BatchItem, input <-chan BatchItem, results chan<- BatchResult) {
+	defer close(results)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queues := make(map[string][]batchTask)
+	// hosts with queued tasks, in the order they are served
+	var hosts []string
+	queued, running := 0, 0
+	hostRunning := make(map[string]int)
+	done := make(chan batchTask)
+	var abortErr error
+	received := 0
+	enqueue := func(item BatchItem) {
+		task := batchTask{result: BatchResult{Index: received, Item: item}, host: requestHost(item.Request)}
+		received++
+		if len(queues[task.host]) == 0 {
+			hosts = append(hosts, task.host)
+		}
+		queues[task.host] = append(queues[task.host], task)
+		queued++
+	}
+	for _, item := range items {
+		enqueue(item)
+	}
+
+	for input != nil || queued > 0 || running > 0 {
+		for abortErr == nil && running < b.Concurrency {
+			i := b.nextHost(hosts, hostRunning)
+			if i < 0 {
+				break
+			}
+			host := hosts[i]
+			task := queues[host][0]
+			queues[host] = queues[host][1:]
+			hosts = append(hosts[:i], hosts[i+1:]...)
+			if len(queues[host]) > 0 {
+				hosts = append(hosts, host)
+			} else {
+				delete(queues, host)
+			}
+			queued--
+			running++
+			hostRunning[host]++
+			go func() {
+				task.result.Err = b.Client.PerformRequest(ctx, task.result.Item.Request, task.result.Item.Response)
+				done <- task
+			}()
+		}
+
+		// items for hosts at their limit are buffered to find work for
+		// other hosts, up to the read-ahead limit
+		receive := input
+		if queued >= batchReadAhead*b.Concurrency || (queued >= b.Concurrency && b.nextHost(hosts, hostRunning) >= 0) {
+			receive = nil
+		}
+		ctxDone := ctx.Done()
+		if abortErr != nil {
+			ctxDone = nil
+		}
+		select {
+		case item, ok := <-receive:
+			if !ok {
+				input = nil
+				continue
+			}
+			if abortErr != nil {
+				results <- BatchResult{Index: received, Item: item, Err: abortErr}
+				received++
+				continue
+			}
+			enqueue(item)
+		case task := <-done:
+			running--
+			hostRunning[task.host]--
+			if hostRunning[task.host] == 0 {
+				delete(hostRunning, task.host)
+			}
+			results <- task.result
+			if task.result.Err != nil && b.FailFast && abortErr == nil {
+				abortErr = ErrBatchSkipped
+				cancel()
+			}
+		case <-ctxDone:
+			abortErr = ctx.Err()
+		}
+
+		if abortErr != nil && queued > 0 {
+			for _, host := range hosts {
+				for _, task := range queues[host] {
+					task.result.Err = abortErr
+					results <- task.result
+				}
+			}
+			clear(queues)
+			hosts, queued = nil, 0
+		}
+	}
+}
+
+// nextHost returns the index in hosts of the first one below its limit, or -1.
+func (b *BatchExecutor) nextHost(hosts []string, hostRunning map[string]int) int {
+	for i, host := range hosts {
+		if b.PerHostConcurrency == 0 || hostRunning[host] < b.PerHostConcurrency {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,224 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchTestClient records requests and the peak number of them in flight,
+// overall and per host.
+type batchTestClient struct {
+	perform func(ctx context.Context, req Request) error
+
+	mu         sync.Mutex
+	order      []string
+	inFlight   map[string]int
+	total      int
+	maxTotal   int
+	maxPerHost map[string]int
+}
+
+func newBatchTestClient(perform func(ctx context.Context, req Request) error) *batchTestClient {
+	return &batchTestClient{perform: perform, inFlight: map[string]int{}, maxPerHost: map[string]int{}}
+}
+
+func (c *batchTestClient) PerformRequest(ctx context.Context, req Request, resp Response) error {
+	host := requestHost(req)
+	c.mu.Lock()
+	c.order = append(c.order, req.URL())
+	c.total++
+	c.inFlight[host]++
+	c.maxTotal = max(c.maxTotal, c.total)
+	c.maxPerHost[host] = max(c.maxPerHost[host], c.inFlight[host])
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.total--
+		c.inFlight[host]--
+		c.mu.Unlock()
+	}()
+	return c.perform(ctx, req)
+}
+
+func batchItems(urls ...string) []BatchItem {
+	items := make([]BatchItem, len(urls))
+	for i, url := range urls {
+		items[i] = BatchItem{Request: testGet(url), Response: &testResponse{}}
+	}
+	return items
+}
+
+func TestBatchConcurrencyLimits(t *testing.T) {
+	var urls []string
+	for i := 0; i < 30; i++ {
+		urls = append(urls, fmt.Sprintf("http://host%d.test/%d", i%3, i))
+	}
+	release := make(chan struct{})
+	client := newBatchTestClient(func(context.Context, Request) error {
+		<-release
+		return nil
+	})
+	batch, err := NewBatchExecutor(BatchConfig{Concurrency: 4, PerHostConcurrency: 2}, client)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- batch.Run(context.Background(), batchItems(urls...)) }()
+	// the first requests hold all slots until released
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.total == 4
+	}, time.Second, time.Millisecond)
+	close(release)
+	require.NoError(t, <-done)
+
+	assert.Len(t, client.order, 30)
+	assert.Equal(t, 4, client.maxTotal)
+	for host, peak := range client.maxPerHost {
+		assert.LessOrEqual(t, peak, 2, host)
+	}
+}
+
+func TestBatchHostFairness(t *testing.T) {
+	urls := []string{"http://a.test/1", "http://a.test/2", "http://a.test/3", "http://a.test/4", "http://b.test/1", "http://c.test/1", "http://b.test/2"}
+	client := newBatchTestClient(func(context.Context, Request) error { return nil })
+	batch, err := NewBatchExecutor(BatchConfig{Concurrency: 1}, client)
+	require.NoError(t, err)
+
+	require.NoError(t, batch.Run(context.Background(), batchItems(urls...)))
+	assert.Equal(t, []string{
+		"http://a.test/1", "http://b.test/1", "http://c.test/1",
+		"http://a.test/2", "http://b.test/2", "http://a.test/3", "http://a.test/4",
+	}, client.order)
+}
+
+func TestBatchErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+	failing := func(ctx context.Context, req Request) error {
+		if req.URL() == "http://api.test/2" || req.URL() == "http://api.test/4" {
+			return errFailed
+		}
+		return nil
+	}
+	urls := []string{"http://api.test/0", "http://api.test/1", "http://api.test/2", "http://api.test/3", "http://api.test/4", "http://api.test/5"}
+
+	for _, tc := range []struct {
+		Name       string
+		FailFast   bool
+		WantErrors []error
+	}{
+		{
+			Name:       "collect all",
+			WantErrors: []error{nil, nil, errFailed, nil, errFailed, nil},
+		},
+		{
+			Name:       "fail fast",
+			FailFast:   true,
+			WantErrors: []error{nil, nil, errFailed, ErrBatchSkipped, ErrBatchSkipped, ErrBatchSkipped},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			batch, err := NewBatchExecutor(BatchConfig{Concurrency: 1, FailFast: tc.FailFast}, newBatchTestClient(failing))
+			require.NoError(t, err)
+
+			err = batch.Run(context.Background(), batchItems(urls...))
+			var batchErr *BatchError
+			require.ErrorAs(t, err, &batchErr)
+			assert.Equal(t, tc.WantErrors, batchErr.Errors)
+			assert.ErrorIs(t, err, errFailed)
+			assert.ErrorContains(t, err, "of 6 requests failed: failed")
+		})
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	started := make(chan struct{}, 10)
+	client := newBatchTestClient(func(ctx context.Context, req Request) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	batch, err := NewBatchExecutor(BatchConfig{Concurrency: 2}, client)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		<-started
+		cancel()
+	}()
+	err = batch.Run(ctx, batchItems("http://a.test/1", "http://b.test/1", "http://a.test/2", "http://b.test/2", "http://a.test/3"))
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, []error{context.Canceled, context.Canceled, context.Canceled, context.Canceled, context.Canceled}, batchErr.Errors)
+	assert.Len(t, client.order, 2)
+}
+
+func TestBatchRunChan(t *testing.T) {
+	batch, err := NewBatchExecutor(BatchConfig{Concurrency: 3, PerHostConcurrency: 1}, newBatchTestClient(func(context.Context, Request) error { return nil }))
+	require.NoError(t, err)
+
+	input := make(chan BatchItem)
+	go func() {
+		defer close(input)
+		for i := 0; i < 20; i++ {
+			input <- BatchItem{Request: testGet(fmt.Sprintf("http://host%d.test/%d", i%4, i)), Response: &testResponse{}}
+		}
+	}()
+
+	seen := map[int]bool{}
+	for result := range batch.RunChan(context.Background(), input) {
+		assert.NoError(t, result.Err)
+		assert.Equal(t, fmt.Sprintf("http://host%d.test/%d", result.Index%4, result.Index), result.Item.Request.URL())
+		seen[result.Index] = true
+	}
+	assert.Len(t, seen, 20)
+}
+
+func TestBatchRunChanReadAhead(t *testing.T) {
+	release := make(chan struct{})
+	batch, err := NewBatchExecutor(BatchConfig{Concurrency: 2, PerHostConcurrency: 1}, newBatchTestClient(func(ctx context.Context, req Request) error {
+		<-release
+		return nil
+	}))
+	require.NoError(t, err)
+
+	var sent atomic.Int32
+	input := make(chan BatchItem)
+	go func() {
+		defer close(input)
+		for i := 0; i < 100; i++ {
+			input <- BatchItem{Request: testGet(fmt.Sprintf("http://a.test/%d", i)), Response: &testResponse{}}
+			sent.Add(1)
+		}
+	}()
+
+	results := batch.RunChan(context.Background(), input)
+	// one request in flight and 4 times Concurrency queued
+	assert.Eventually(t, func() bool { return sent.Load() == 9 }, time.Second, time.Millisecond)
+	assert.Never(t, func() bool { return sent.Load() > 9 }, 20*time.Millisecond, time.Millisecond)
+
+	close(release)
+	count := 0
+	for result := range results {
+		assert.NoError(t, result.Err)
+		count++
+	}
+	assert.Equal(t, 100, count)
+}
+
+func TestNewBatchExecutorErrors(t *testing.T) {
+	_, err := NewBatchExecutor(BatchConfig{}, nil)
+	assert.ErrorContains(t, err, "client is nil")
+	_, err = NewBatchExecutor(BatchConfig{PerHostConcurrency: -1}, successClient(t))
+	assert.ErrorContains(t, err, "invalid concurrency 0/-1")
+}
@@ -0,0 +1,327 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+type CircuitBreakerConfig struct {
+	FailureRatio     float64
+	MinRequests      int
+	Window           time.Duration
+	Cooldown         time.Duration
+	HalfOpenRequests int
+	IsFailure        func(error) bool
+	OnStateChange    func(host string, from, to CircuitState)
+	Now              func() time.Time
+}
+
+// CircuitBreakerClient is a Client decorator tracking failures per host.
+// A closed circuit opens when at least MinRequests were made during Window and
+// the share of failed ones reaches FailureRatio. Requests to a host with an
+// open circuit fail with ErrCircuitOpen until Cooldown passes, then up to
+// HalfOpenRequests trial requests are let through: the circuit closes when
+// all of them succeed and opens again on the first failure. Requests
+// cancelled with context.Canceled count neither as a success nor as a
+// failure, and a cancelled trial lets another one through.
+//
+// Responses with a 5xx status are failures even when they are not returned as
+// *StatusError, and errors returned by ProcessResponse of the caller do not
+// count: the host did answer. IsFailure classifies the other errors, by
+// default network errors and *StatusError with a 5xx status are failures.
+// Hosts with a closed circuit and no request during Window are forgotten.
+type CircuitBreakerClient struct {
+	Next             Client
+	FailureRatio     float64
+	MinRequests      int
+	Window           time.Duration
+	Cooldown         time.Duration
+	HalfOpenRequests int
+	IsFailure        func(error) bool
+	OnStateChange    func(host string, from, to CircuitState)
+	Now              func() time.Time
+
+	mu        sync.Mutex
+	hosts     map[string]*hostCircuit
+	lastSweep time.Time
+}
+
+var _ Client = (*CircuitBreakerClient)(nil)
+
+type hostCircuit struct {
+	state       CircuitState
+	generation  uint64
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	inFlight    int
+	successes   int
+}
+
+type circuitOutcome int
+
+const (
+	circuitSuccess circuitOutcome = iota
+	circuitFailure
+	circuitIgnored
+)
+
+type stateChange struct {
+	host     string
+	from, to CircuitState
+}
+
+func NewCircuitBreakerClient(cfg CircuitBreakerConfig, next Client) (*CircuitBreakerClient, error) {
+	if next == nil {
+		return nil, errors.New("circuit breaker: next client is nil")
+	}
+	if cfg.FailureRatio < 0 || cfg.FailureRatio > 1 {
+		return nil, fmt.Errorf("circuit breaker: invalid failure ratio %v", cfg.FailureRatio)
+	}
+
+	c := &CircuitBreakerClient{
+		Next:             next,
+		FailureRatio:     cfg.FailureRatio,
+		MinRequests:      cfg.MinRequests,
+		Window:           cfg.Window,
+		Cooldown:         cfg.Cooldown,
+		HalfOpenRequests: cfg.HalfOpenRequests,
+		IsFailure:        cfg.IsFailure,
+		OnStateChange:    cfg.OnStateChange,
+		Now:              cfg.Now,
+		hosts:            make(map[string]*hostCircuit),
+	}
+	if c.FailureRatio == 0 {
+		c.FailureRatio = 0.5
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 10
+	}
+	if c.Window <= 0 {
+		c.Window = time.Minute
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = isCircuitFailure
+	}
+	if c.Now == nil {
+		c.Now = time.Now
+	}
+	return c, nil
+}
+
+// isCircuitFailure counts network errors and 5xx statuses as failures.
+// Cancelled requests and 4xx statuses tell nothing about host health.
+func isCircuitFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+func (c *CircuitBreakerClient) PerformRequest(ctx context.Context, req Request, resp Response) error {
+	host := requestHost(req)
+	hc, generation, err := c.allow(host)
+	if err != nil {
+		return err
+	}
+	cResp := &circuitResponse{Response: resp}
+	err = c.Next.PerformRequest(ctx, req, cResp)
+	outcome := circuitSuccess
+	switch {
+	case errors.Is(err, context.Canceled):
+		outcome = circuitIgnored
+	case cResp.processed:
+		if cResp.statusCode >= 500 {
+			outcome = circuitFailure
+		}
+	case c.IsFailure(err):
+		outcome = circuitFailure
+	}
+	c.record(host, hc, generation, outcome)
+	return err
+}
+
+// circuitResponse records the status of the response passed to the wrapped
+// Response.
+type circuitResponse struct {
+	Response
+	processed  bool
+	statusCode int
+}
+
+func (r *circuitResponse) ProcessResponse(netResp *http.Response) error {
+	r.processed, r.statusCode = true, netResp.StatusCode
+	return r.Response.ProcessResponse(netResp)
+}
+
+func (r *circuitResponse) Unwrap() Response {
+	return r.Response
+}
+
+// State returns the current circuit state for host.
+func (c *CircuitBreakerClient) State(host string) CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hc, ok := c.hosts[host]; ok {
+		return hc.state
+	}
+	return CircuitClosed
+}
+
+func requestHost(req Request) string {
+	u, err := url.Parse(req.URL())
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func (c *CircuitBreakerClient) allow(host string) (*hostCircuit, uint64, error) {
+	var changes []stateChange
+	defer func() { c.notify(changes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.Now()
+	c.sweep(now)
+	hc, ok := c.hosts[host]
+	if !ok {
+		hc = &hostCircuit{windowStart: now}
+		c.hosts[host] = hc
+	}
+
+	switch hc.state {
+	case CircuitClosed:
+		if now.Sub(hc.windowStart) >= c.Window {
+			hc.windowStart, hc.requests, hc.failures = now, 0, 0
+		}
+	case CircuitOpen:
+		if now.Sub(hc.openedAt) < c.Cooldown {
+			return nil, 0, fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+		changes = append(changes, c.setState(host, hc, CircuitHalfOpen, now))
+		fallthrough
+	case CircuitHalfOpen:
+		if hc.inFlight+hc.successes >= c.HalfOpenRequests {
+			return nil, 0, fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+		}
+		hc.inFlight++
+	}
+	return hc, hc.generation, nil
+}
+
+// sweep forgets closed circuits whose window ended, at most once per Window:
+// they hold nothing a new circuit would not.
+func (c *CircuitBreakerClient) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.Window {
+		return
+	}
+	c.lastSweep = now
+	for host, hc := range c.hosts {
+		if hc.state == CircuitClosed && now.Sub(hc.windowStart) >= c.Window {
+			delete(c.hosts, host)
+		}
+	}
+}
+
+func (c *CircuitBreakerClient) record(host string, hc *hostCircuit, generation uint64, outcome circuitOutcome) {
+	var changes []stateChange
+	defer func() { c.notify(changes) }()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hosts[host] != hc || hc.generation != generation {
+		// the request was admitted before the last state change, or the
+		// circuit was forgotten meanwhile
+		return
+	}
+
+	now := c.Now()
+	switch hc.state {
+	case CircuitClosed:
+		if outcome == circuitIgnored {
+			return
+		}
+		hc.requests++
+		if outcome == circuitFailure {
+			hc.failures++
+		}
+		if hc.requests >= c.MinRequests && float64(hc.failures) >= c.FailureRatio*float64(hc.requests) {
+			changes = append(changes, c.setState(host, hc, CircuitOpen, now))
+		}
+	case CircuitHalfOpen:
+		hc.inFlight--
+		if outcome == circuitIgnored {
+			return
+		}
+		if outcome == circuitFailure {
+			changes = append(changes, c.setState(host, hc, CircuitOpen, now))
+			return
+		}
+		hc.successes++
+		if hc.successes >= c.HalfOpenRequests {
+			changes = append(changes, c.setState(host, hc, CircuitClosed, now))
+		}
+	}
+}
+
+func (c *CircuitBreakerClient) setState(host string, hc *hostCircuit, state CircuitState, now time.Time) stateChange {
+	change := stateChange{host: host, from: hc.state, to: state}
+	hc.state = state
+	hc.generation++
+	hc.windowStart, hc.requests, hc.failures = now, 0, 0
+	hc.inFlight, hc.successes = 0, 0
+	if state == CircuitOpen {
+		hc.openedAt = now
+	}
+	return change
+}
+
+func (c *CircuitBreakerClient) notify(changes []stateChange) {
+	if c.OnStateChange == nil {
+		return
+	}
+	for _, change := range changes {
+		c.OnStateChange(change.host, change.from, change.to)
+	}
+}
@@ -0,0 +1,251 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func testGet(url string) testRequest {
+	return testRequest{method: http.MethodGet, url: url}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := newFakeClock()
+	failing := map[string]bool{"bad.example": true}
+	var changes []string
+
+	next := NewMockClient(t)
+	next.EXPECT().PerformRequest(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(
+		func(ctx context.Context, req Request, res Response) error {
+			if failing[requestHost(req)] {
+				return errors.New("WTF")
+			}
+			return nil
+		})
+
+	client, newError := NewCircuitBreakerClient(CircuitBreakerConfig{
+		FailureRatio:     0.5,
+		MinRequests:      4,
+		Window:           time.Minute,
+		Cooldown:         10 * time.Second,
+		HalfOpenRequests: 2,
+		Now:              clock.Now,
+		OnStateChange: func(host string, from, to CircuitState) {
+			changes = append(changes, fmt.Sprintf("%s %s->%s", host, from, to))
+		},
+	}, next)
+	require.NoError(t, newError)
+
+	ctx := context.Background()
+	good, bad := testGet("http://good.example/"), testGet("http://bad.example/path")
+
+	// failures below MinRequests keep the circuit closed
+	for i := 0; i < 3; i++ {
+		assert.EqualError(t, client.PerformRequest(ctx, bad, nil), "WTF")
+	}
+	assert.Equal(t, CircuitClosed, client.State("bad.example"))
+
+	// the fourth failure opens it, other hosts are not affected
+	assert.EqualError(t, client.PerformRequest(ctx, bad, nil), "WTF")
+	assert.Equal(t, CircuitOpen, client.State("bad.example"))
+	assert.NoError(t, client.PerformRequest(ctx, good, nil))
+	assert.Equal(t, CircuitClosed, client.State("good.example"))
+
+	gotError := client.PerformRequest(ctx, bad, nil)
+	assert.True(t, errors.Is(gotError, ErrCircuitOpen))
+	assert.Contains(t, gotError.Error(), "bad.example")
+
+	// after cooldown a failed trial opens the circuit again
+	clock.Advance(10 * time.Second)
+	assert.EqualError(t, client.PerformRequest(ctx, bad, nil), "WTF")
+	assert.Equal(t, CircuitOpen, client.State("bad.example"))
+	assert.ErrorIs(t, client.PerformRequest(ctx, bad, nil), ErrCircuitOpen)
+
+	// successful trials close it
+	clock.Advance(10 * time.Second)
+	failing["bad.example"] = false
+	assert.NoError(t, client.PerformRequest(ctx, bad, nil))
+	assert.Equal(t, CircuitHalfOpen, client.State("bad.example"))
+	assert.NoError(t, client.PerformRequest(ctx, bad, nil))
+	assert.Equal(t, CircuitClosed, client.State("bad.example"))
+
+	assert.Equal(t, []string{
+		"bad.example closed->open",
+		"bad.example open->half-open",
+		"bad.example half-open->open",
+		"bad.example open->half-open",
+		"bad.example half-open->closed",
+	}, changes)
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	clock := newFakeClock()
+	next := NewMockClient(t)
+	next.EXPECT().PerformRequest(mock.Anything, mock.Anything, mock.Anything).Return(errors.New("WTF"))
+
+	client, newError := NewCircuitBreakerClient(CircuitBreakerConfig{
+		MinRequests: 2,
+		Window:      time.Second,
+		Now:         clock.Now,
+	}, next)
+	require.NoError(t, newError)
+
+	req := testGet("http://host.example/")
+	client.PerformRequest(context.Background(), req, nil)
+	clock.Advance(time.Second)
+	client.PerformRequest(context.Background(), req, nil)
+	assert.Equal(t, CircuitClosed, client.State("host.example"))
+	client.PerformRequest(context.Background(), req, nil)
+	assert.Equal(t, CircuitOpen, client.State("host.example"))
+}
+
+func TestCircuitBreakerHalfOpenLimit(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	fail := true
+
+	next := NewMockClient(t)
+	next.EXPECT().PerformRequest(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(
+		func(ctx context.Context, req Request, res Response) error {
+			if fail {
+				return errors.New("WTF")
+			}
+			started <- struct{}{}
+			<-release
+			return nil
+		})
+
+	client, newError := NewCircuitBreakerClient(CircuitBreakerConfig{MinRequests: 1, Cooldown: time.Second, Now: clock.Now}, next)
+	require.NoError(t, newError)
+
+	req := testGet("http://host.example/")
+	client.PerformRequest(context.Background(), req, nil)
+	assert.Equal(t, CircuitOpen, client.State("host.example"))
+
+	clock.Advance(time.Second)
+	fail = false
+	done := make(chan error)
+	go func() { done <- client.PerformRequest(context.Background(), req, nil) }()
+	<-started
+
+	assert.ErrorIs(t, client.PerformRequest(context.Background(), req, nil), ErrCircuitOpen)
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, CircuitClosed, client.State("host.example"))
+}
+
+func TestCircuitBreakerCancelled(t *testing.T) {
+	clock := newFakeClock()
+	outcomes := []error{errors.New("WTF"), context.Canceled, errors.New("WTF"), context.Canceled, nil}
+	next := NewMockClient(t)
+	next.EXPECT().PerformRequest(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(
+		func(ctx context.Context, req Request, res Response) error {
+			err := outcomes[0]
+			outcomes = outcomes[1:]
+			return err
+		})
+
+	client, newError := NewCircuitBreakerClient(CircuitBreakerConfig{FailureRatio: 1, MinRequests: 2, Cooldown: time.Second, Now: clock.Now}, next)
+	require.NoError(t, newError)
+	req := testGet("http://host.example/")
+
+	// a cancelled request does not lower the failure ratio
+	client.PerformRequest(context.Background(), req, nil)
+	client.PerformRequest(context.Background(), req, nil)
+	assert.Equal(t, CircuitClosed, client.State("host.example"))
+	client.PerformRequest(context.Background(), req, nil)
+	assert.Equal(t, CircuitOpen, client.State("host.example"))
+
+	// a cancelled trial neither closes the circuit nor holds its slot
+	clock.Advance(time.Second)
+	assert.ErrorIs(t, client.PerformRequest(context.Background(), req, nil), context.Canceled)
+	assert.Equal(t, CircuitHalfOpen, client.State("host.example"))
+	assert.NoError(t, client.PerformRequest(context.Background(), req, nil))
+	assert.Equal(t, CircuitClosed, client.State("host.example"))
+}
+
+func TestCircuitBreakerResponseStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+	}))
+	defer server.Close()
+	native, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client, newError := NewCircuitBreakerClient(CircuitBreakerConfig{FailureRatio: 0.5, MinRequests: 2}, native)
+	require.NoError(t, newError)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	// decode errors of the caller are not host failures
+	for i := 0; i < 2; i++ {
+		err := client.PerformRequest(context.Background(), testGet(server.URL), &JSONResponse[int]{})
+		assert.ErrorIs(t, err, io.EOF)
+	}
+	assert.Equal(t, CircuitClosed, client.State(host))
+
+	// 5xx responses fail without CheckStatus
+	for i := 0; i < 2; i++ {
+		resp := &testResponse{}
+		require.NoError(t, client.PerformRequest(context.Background(), testGet(server.URL+"/fail"), resp))
+		assert.Equal(t, http.StatusInternalServerError, resp.code)
+	}
+	assert.Equal(t, CircuitOpen, client.State(host))
+}
+
+func TestCircuitBreakerForgetsIdleHosts(t *testing.T) {
+	clock := newFakeClock()
+	client, newError := NewCircuitBreakerClient(CircuitBreakerConfig{MinRequests: 1, Window: time.Minute, Now: clock.Now}, NewMockClient(t))
+	require.NoError(t, newError)
+	client.Next.(*MockClient).EXPECT().PerformRequest(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(
+		func(ctx context.Context, req Request, res Response) error {
+			if requestHost(req) == "bad.example" {
+				return errors.New("WTF")
+			}
+			return nil
+		})
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, client.PerformRequest(context.Background(), testGet(fmt.Sprintf("http://host%d.example/", i)), nil))
+	}
+	client.PerformRequest(context.Background(), testGet("http://bad.example/"), nil)
+	assert.Len(t, client.hosts, 11)
+
+	clock.Advance(time.Minute)
+	require.NoError(t, client.PerformRequest(context.Background(), testGet("http://host0.example/"), nil))
+	assert.Len(t, client.hosts, 2)
+	assert.Equal(t, CircuitOpen, client.State("bad.example"))
+}
+
+func TestIsCircuitFailure(t *testing.T) {
+	assert.False(t, isCircuitFailure(nil))
+	assert.False(t, isCircuitFailure(context.Canceled))
+	assert.False(t, isCircuitFailure(&StatusError{StatusCode: http.StatusNotFound}))
+	assert.True(t, isCircuitFailure(&StatusError{StatusCode: http.StatusBadGateway}))
+	assert.True(t, isCircuitFailure(errors.New("WTF")))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 )
 
 type Client interface {
@@ -25,6 +26,50 @@ type RequestWithBody interface {
 	Body() io.Reader
 }
 
+// RequestWithReplayableBody is a request able to produce a fresh body for
+// every attempt, so retries and 307/308 redirects can resend it.
+// ContentLength returns -1 when the length is unknown.
+type RequestWithReplayableBody interface {
+	Request
+	GetBody() (io.ReadCloser, error)
+	ContentLength() int64
+}
+
+// RequestWithURLTemplate reports a low-cardinality form of the URL, such as
+// "/users/{id}", used to name tracing spans.
+type RequestWithURLTemplate interface {
+	Request
+	URLTemplate() string
+}
+
+// RequestOptions override client settings for a single request. Zero values
+// keep the client settings. Timeout can only shorten the http.Client timeout.
+// FollowRedirect and RedirectPolicy are honored by clients built with
+// NewNetHTTPClient; a RedirectPolicy follows redirects unless FollowRedirect
+// is false. Idempotent marks requests HedgingClient and RetryClient may send
+// more than once whatever their method.
+type RequestOptions struct {
+	Timeout               time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleReadTimeout       time.Duration
+	FollowRedirect        *bool
+	RedirectPolicy        *RedirectPolicy
+	UserAgent             string
+	Idempotent            bool
+}
+
+type RequestWithOptions interface {
+	Request
+	Options() RequestOptions
+}
+
 type Response interface {
 	ProcessResponse(r *http.Response) error
 }
+
+// ResponseWithTimings receives the timing breakdown of the request after
+// ProcessResponse returns, or after the request fails.
+type ResponseWithTimings interface {
+	Response
+	SetTimings(t Timings)
+}
@@ -1,16 +1,27 @@
 package httpoh
 
-import "time"
+import (
+	"net/http"
+	"time"
+)
 
 type Config struct {
-	UserAgent           string
-	MaxIdleConnsPerHost int
-	MaxConnsPerHost     int
-	ConnectTimeout      time.Duration
-	ReadWriteTimeout    time.Duration
-	TLSHandshakeTimeout time.Duration
-	DisableCompression  bool
-	FollowRedirect      bool
-	InsecureSkipVerify  bool
-	WithNTLM            bool
+	UserAgent            string
+	MaxIdleConnsPerHost  int
+	MaxConnsPerHost      int
+	ConnectTimeout       time.Duration
+	ReadWriteTimeout     time.Duration
+	TLSHandshakeTimeout  time.Duration
+	DisableCompression   bool
+	FollowRedirect       bool
+	RedirectPolicy       *RedirectPolicy
+	InsecureSkipVerify   bool
+	TLS                  TLSConfig
+	Proxy                ProxyConfig
+	DNS                  DNSConfig
+	CookieJar            http.CookieJar
+	WithNTLM             bool
+	CheckStatus          bool
+	StatusErrorBodyLimit int
+	Authenticator        Authenticator
 }
@@ -0,0 +1,434 @@
+package httpoh
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+type CookieFormat int
+
+const (
+	CookieFormatJSON CookieFormat = iota
+	// CookieFormatNetscape is the cookies.txt format of curl and wget. It does
+	// not keep the SameSite attribute.
+	CookieFormatNetscape
+)
+
+// CookieJarOptions configure a CookieJar.
+//
+// PublicSuffixList keeps servers from setting cookies for a whole public
+// suffix such as co.uk, publicsuffix.List from golang.org/x/net by default.
+// File is loaded by NewCookieJar
+// when it exists and written by CookieJar.Save, in Format.
+type CookieJarOptions struct {
+	PublicSuffixList cookiejar.PublicSuffixList
+	File             string
+	Format           CookieFormat
+}
+
+// CookieJar is an in-memory http.CookieJar, built on net/http/cookiejar, that
+// can list, clear, export and import its cookies.
+type CookieJar struct {
+	options CookieJarOptions
+
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	cookies map[string]storedCookie
+}
+
+var _ http.CookieJar = (*CookieJar)(nil)
+
+// storedCookie mirrors a cookie kept by the cookiejar.Jar, which does not
+// expose them.
+type storedCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Domain   string     `json:"domain"`
+	HostOnly bool       `json:"host_only"`
+	Path     string     `json:"path"`
+	Secure   bool       `json:"secure"`
+	HttpOnly bool       `json:"http_only"`
+	SameSite string     `json:"same_site,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+func NewCookieJar(opts CookieJarOptions) (*CookieJar, error) {
+	if opts.Format != CookieFormatJSON && opts.Format != CookieFormatNetscape {
+		return nil, fmt.Errorf("cookie jar: invalid format %d", opts.Format)
+	}
+	if opts.PublicSuffixList == nil {
+		opts.PublicSuffixList = publicsuffix.List
+	}
+	j := &CookieJar{options: opts}
+	j.reset()
+	if opts.File == "" {
+		return j, nil
+	}
+	f, err := os.Open(opts.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cookie jar: %w", err)
+	}
+	defer f.Close()
+	if err := j.Import(f, opts.Format); err != nil {
+		return nil, fmt.Errorf("cookie jar: %s: %w", opts.File, err)
+	}
+	return j, nil
+}
+
+func (j *CookieJar) reset() {
+	// cookiejar.New never fails
+	j.jar, _ = cookiejar.New(&cookiejar.Options{PublicSuffixList: j.options.PublicSuffixList})
+	j.cookies = make(map[string]storedCookie)
+}
+
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.setCookies(u, cookies, time.Now())
+}
+
+func (j *CookieJar) setCookies(u *url.URL, cookies []*http.Cookie, now time.Time) {
+	j.jar.SetCookies(u, cookies)
+	for _, cookie := range cookies {
+		stored, remove := newStoredCookie(u, cookie, now)
+		key := stored.Domain + ";" + stored.Path + ";" + stored.Name
+		if remove {
+			delete(j.cookies, key)
+		} else if j.accepted(stored) {
+			j.cookies[key] = stored
+		}
+	}
+}
+
+// accepted tells if the cookiejar.Jar kept the cookie rather than rejecting
+// its domain.
+func (j *CookieJar) accepted(c storedCookie) bool {
+	for _, cookie := range j.jar.Cookies(c.url()) {
+		if cookie.Name == c.Name && cookie.Value == c.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jar.Cookies(u)
+}
+
+// All returns all unexpired cookies ordered by domain, path and name. Domain
+// is set on each of them, prefixed with a dot when the cookie is sent to
+// subdomains as well.
+func (j *CookieJar) All() []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	stored := j.unexpired(time.Now())
+	cookies := make([]*http.Cookie, len(stored))
+	for i, c := range stored {
+		cookies[i] = c.cookie()
+		if !c.HostOnly {
+			cookies[i].Domain = "." + c.Domain
+		}
+	}
+	return cookies
+}
+
+func (j *CookieJar) unexpired(now time.Time) []storedCookie {
+	var stored []storedCookie
+	for key, c := range j.cookies {
+		if c.Expires != nil && !c.Expires.After(now) {
+			delete(j.cookies, key)
+			continue
+		}
+		stored = append(stored, c)
+	}
+	sort.Slice(stored, func(a, b int) bool {
+		if stored[a].Domain != stored[b].Domain {
+			return stored[a].Domain < stored[b].Domain
+		}
+		if stored[a].Path != stored[b].Path {
+			return stored[a].Path < stored[b].Path
+		}
+		return stored[a].Name < stored[b].Name
+	})
+	return stored
+}
+
+// Clear removes all cookies.
+func (j *CookieJar) Clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.reset()
+}
+
+// Save writes the cookies to the File of the jar options, replacing it.
+func (j *CookieJar) Save() error {
+	if j.options.File == "" {
+		return errors.New("cookie jar: no file to save to")
+	}
+	f, err := os.CreateTemp(filepath.Dir(j.options.File), filepath.Base(j.options.File)+".*")
+	if err != nil {
+		return fmt.Errorf("cookie jar: %w", err)
+	}
+	defer os.Remove(f.Name())
+	err = j.Export(f, j.options.Format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), j.options.File)
+	}
+	if err != nil {
+		return fmt.Errorf("cookie jar: %w", err)
+	}
+	return nil
+}
+
+// Export writes unexpired cookies, session cookies included, in format.
+func (j *CookieJar) Export(w io.Writer, format CookieFormat) error {
+	j.mu.Lock()
+	stored := j.unexpired(time.Now())
+	j.mu.Unlock()
+
+	switch format {
+	case CookieFormatJSON:
+		if stored == nil {
+			stored = []storedCookie{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stored)
+	case CookieFormatNetscape:
+		bw := bufio.NewWriter(w)
+		bw.WriteString("# Netscape HTTP Cookie File\n\n")
+		for _, c := range stored {
+			domain := c.Domain
+			if !c.HostOnly {
+				domain = "." + domain
+			}
+			if c.HttpOnly {
+				domain = "#HttpOnly_" + domain
+			}
+			var expires int64
+			if c.Expires != nil {
+				expires = c.Expires.Unix()
+			}
+			fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				domain, netscapeBool(!c.HostOnly), c.Path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+		}
+		return bw.Flush()
+	}
+	return fmt.Errorf("invalid cookie format %d", format)
+}
+
+// Import adds cookies read in format to the jar. Expired ones are skipped.
+func (j *CookieJar) Import(r io.Reader, format CookieFormat) error {
+	var stored []storedCookie
+	switch format {
+	case CookieFormatJSON:
+		if err := json.NewDecoder(r).Decode(&stored); err != nil {
+			return err
+		}
+	case CookieFormatNetscape:
+		var err error
+		if stored, err = parseNetscapeCookies(r); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid cookie format %d", format)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	for _, c := range stored {
+		if c.Name == "" || c.Domain == "" {
+			return fmt.Errorf("cookie %q: name and domain are required", c.Name)
+		}
+		if c.Expires != nil && !c.Expires.After(now) {
+			continue
+		}
+		if c.Path == "" {
+			c.Path = "/"
+		}
+		cookie := c.cookie()
+		if c.HostOnly {
+			cookie.Domain = ""
+		}
+		j.setCookies(c.url(), []*http.Cookie{cookie}, now)
+	}
+	return nil
+}
+
+func parseNetscapeCookies(r io.Reader) ([]storedCookie, error) {
+	var stored []storedCookie
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if rest, found := strings.CutPrefix(text, "#HttpOnly_"); found {
+			text, httpOnly = rest, true
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) == 6 {
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("line %d: expected 7 tab separated fields, got %d", line, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid expiry %q", line, fields[4])
+		}
+		c := storedCookie{
+			Domain:   strings.TrimPrefix(fields[0], "."),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			t := time.Unix(expires, 0).UTC()
+			c.Expires = &t
+		}
+		stored = append(stored, c)
+	}
+	return stored, scanner.Err()
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// newStoredCookie applies the defaults of RFC 6265 to a cookie set by u. It
+// reports cookies deleting a previous one with remove.
+func newStoredCookie(u *url.URL, cookie *http.Cookie, now time.Time) (c storedCookie, remove bool) {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	c = storedCookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   strings.TrimPrefix(strings.ToLower(cookie.Domain), "."),
+		Path:     cookie.Path,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: sameSiteNames[cookie.SameSite],
+	}
+	if c.Domain == "" || net.ParseIP(host) != nil {
+		c.Domain, c.HostOnly = host, true
+	}
+	if c.Path == "" || c.Path[0] != '/' {
+		c.Path = "/"
+		if i := strings.LastIndex(u.Path, "/"); i > 0 {
+			c.Path = u.Path[:i]
+		}
+	}
+	switch {
+	case cookie.MaxAge < 0:
+		return c, true
+	case cookie.MaxAge > 0:
+		expires := now.Add(time.Duration(cookie.MaxAge) * time.Second).UTC()
+		c.Expires = &expires
+	case !cookie.Expires.IsZero():
+		if !cookie.Expires.After(now) {
+			return c, true
+		}
+		expires := cookie.Expires.UTC()
+		c.Expires = &expires
+	}
+	return c, false
+}
+
+var sameSiteNames = map[http.SameSite]string{
+	http.SameSiteLaxMode:    "Lax",
+	http.SameSiteStrictMode: "Strict",
+	http.SameSiteNoneMode:   "None",
+}
+
+func (c storedCookie) cookie() *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   c.Domain,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+	for mode, name := range sameSiteNames {
+		if strings.EqualFold(c.SameSite, name) {
+			cookie.SameSite = mode
+		}
+	}
+	if c.Expires != nil {
+		cookie.Expires = *c.Expires
+	}
+	return cookie
+}
+
+// url is a URL the cookie is sent to.
+func (c storedCookie) url() *url.URL {
+	host := c.Domain
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return &url.URL{Scheme: "https", Host: host, Path: c.Path}
+}
+
+// Session is a Client sending requests with the settings of the ClientNative
+// it was created from and a cookie jar of its own, so that one client can
+// hold many independent logins. Connections are shared with the client.
+// Middlewares added to the client after NewSession do not apply to the
+// session.
+type Session struct {
+	Jar    *CookieJar
+	client ClientNative
+}
+
+var _ Client = (*Session)(nil)
+
+func (c *ClientNative) NewSession(opts CookieJarOptions) (*Session, error) {
+	jar, err := NewCookieJar(opts)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := *c.HTTP
+	httpClient.Jar = jar
+	s := &Session{Jar: jar, client: *c}
+	s.client.HTTP = &httpClient
+	s.client.Middlewares = slices.Clip(c.Middlewares)
+	s.client.chain = &clientChain{}
+	return s, nil
+}
+
+func (s *Session) PerformRequest(ctx context.Context, req Request, resp Response) error {
+	return s.client.PerformRequest(ctx, req, resp)
+}
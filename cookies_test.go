@@ -0,0 +1,265 @@
+package httpoh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoginServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: r.URL.Query().Get("user"), Path: "/", HttpOnly: true})
+			http.Redirect(w, r, "/whoami", http.StatusFound)
+		case "/whoami":
+			cookie, err := r.Cookie("session")
+			if err != nil {
+				http.Error(w, "login first", http.StatusUnauthorized)
+				return
+			}
+			io.WriteString(w, cookie.Value)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCookieJarLoginFlow(t *testing.T) {
+	server := newLoginServer(t)
+	jar, err := NewCookieJar(CookieJarOptions{})
+	require.NoError(t, err)
+
+	body, err := proxyGet(t, Config{CookieJar: jar, FollowRedirect: true, CheckStatus: true}, server.URL+"/login?user=alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", body)
+
+	serverURL, _ := url.Parse(server.URL)
+	assert.Equal(t, []*http.Cookie{
+		{Name: "session", Value: "alice", Domain: serverURL.Hostname(), Path: "/", HttpOnly: true},
+	}, jar.All())
+
+	jar.Clear()
+	assert.Empty(t, jar.All())
+	assert.Empty(t, jar.Cookies(serverURL))
+}
+
+func TestSessions(t *testing.T) {
+	server := newLoginServer(t)
+	cfg := Config{FollowRedirect: true, CheckStatus: true}
+	httpClient, err := NewNetHTTPClient(cfg)
+	require.NoError(t, err)
+	client, newError := NewClientNative(cfg, httpClient)
+	require.NoError(t, newError)
+
+	whoami := func(c Client) (string, error) {
+		resp := &rawBodyResponse{}
+		err := c.PerformRequest(context.Background(), testGet(server.URL+"/whoami"), resp)
+		return resp.body, err
+	}
+
+	sessions := map[string]*Session{}
+	for _, user := range []string{"alice", "bob"} {
+		session, err := client.NewSession(CookieJarOptions{})
+		require.NoError(t, err)
+		require.NoError(t, session.PerformRequest(context.Background(), testGet(server.URL+"/login?user="+user), &rawBodyResponse{}))
+		sessions[user] = session
+	}
+
+	for user, session := range sessions {
+		body, err := whoami(session)
+		require.NoError(t, err)
+		assert.Equal(t, user, body)
+	}
+	_, err = whoami(client)
+	assert.ErrorAs(t, err, new(*StatusError))
+	assert.Nil(t, client.HTTP.Jar)
+
+	sessions["alice"].Jar.Clear()
+	_, err = whoami(sessions["alice"])
+	assert.ErrorAs(t, err, new(*StatusError))
+	body, err := whoami(sessions["bob"])
+	require.NoError(t, err)
+	assert.Equal(t, "bob", body)
+}
+
+type testPublicSuffixList map[string]bool
+
+func (l testPublicSuffixList) PublicSuffix(domain string) string {
+	for {
+		if l[domain] {
+			return domain
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			return ""
+		}
+		domain = parent
+	}
+}
+
+func (l testPublicSuffixList) String() string { return "test" }
+
+func TestCookieJarSetCookies(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	u, _ := url.Parse("https://www.shop.co.uk/account/orders")
+
+	for _, tc := range []struct {
+		Name    string
+		Options CookieJarOptions
+		Cookies []*http.Cookie
+		Want    []*http.Cookie
+	}{
+		{
+			Name: "defaults",
+			Cookies: []*http.Cookie{
+				{Name: "host", Value: "1"},
+				{Name: "domain", Value: "2", Domain: ".shop.co.uk", Path: "/", Expires: expires, Secure: true, SameSite: http.SameSiteLaxMode},
+			},
+			Want: []*http.Cookie{
+				{Name: "domain", Value: "2", Domain: ".shop.co.uk", Path: "/", Expires: expires, Secure: true, SameSite: http.SameSiteLaxMode},
+				{Name: "host", Value: "1", Domain: "www.shop.co.uk", Path: "/account"},
+			},
+		},
+		{
+			Name: "foreign domain",
+			Cookies: []*http.Cookie{
+				{Name: "other", Value: "1", Domain: "example.com"},
+			},
+			Want: []*http.Cookie{},
+		},
+		{
+			Name: "deleted and expired",
+			Cookies: []*http.Cookie{
+				{Name: "a", Value: "1", Path: "/"},
+				{Name: "b", Value: "2", Path: "/"},
+				{Name: "a", Value: "", Path: "/", MaxAge: -1},
+				{Name: "c", Value: "3", Path: "/", Expires: time.Now().Add(-time.Hour)},
+			},
+			Want: []*http.Cookie{
+				{Name: "b", Value: "2", Domain: "www.shop.co.uk", Path: "/"},
+			},
+		},
+		{
+			Name: "public suffix rejected by default",
+			Cookies: []*http.Cookie{
+				{Name: "wide", Value: "1", Domain: "co.uk", Path: "/"},
+				{Name: "shop", Value: "2", Domain: "shop.co.uk", Path: "/"},
+			},
+			Want: []*http.Cookie{
+				{Name: "shop", Value: "2", Domain: ".shop.co.uk", Path: "/"},
+			},
+		},
+		{
+			Name:    "public suffix rejected",
+			Options: CookieJarOptions{PublicSuffixList: testPublicSuffixList{"co.uk": true, "uk": true}},
+			Cookies: []*http.Cookie{
+				{Name: "wide", Value: "1", Domain: "co.uk", Path: "/"},
+				{Name: "shop", Value: "2", Domain: "shop.co.uk", Path: "/"},
+			},
+			Want: []*http.Cookie{
+				{Name: "shop", Value: "2", Domain: ".shop.co.uk", Path: "/"},
+			},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			jar, err := NewCookieJar(tc.Options)
+			require.NoError(t, err)
+			jar.SetCookies(u, tc.Cookies)
+			cookies := jar.All()
+			for _, cookie := range cookies {
+				if !cookie.Expires.IsZero() {
+					cookie.Expires = cookie.Expires.Truncate(time.Second)
+				}
+			}
+			assert.Equal(t, tc.Want, cookies)
+		})
+	}
+}
+
+func newTestJar(t *testing.T, opts CookieJarOptions) *CookieJar {
+	jar, err := NewCookieJar(opts)
+	require.NoError(t, err)
+	u, _ := url.Parse("https://www.example.com/")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "s1", HttpOnly: true},
+		{Name: "lang", Value: "en", Domain: "example.com", Path: "/docs", Expires: time.Unix(4102444800, 0), Secure: true},
+	})
+	return jar
+}
+
+func TestCookieJarExport(t *testing.T) {
+	jar := newTestJar(t, CookieJarOptions{})
+
+	var buf bytes.Buffer
+	require.NoError(t, jar.Export(&buf, CookieFormatNetscape))
+	assert.Equal(t, "# Netscape HTTP Cookie File\n\n"+
+		".example.com\tTRUE\t/docs\tTRUE\t4102444800\tlang\ten\n"+
+		"#HttpOnly_www.example.com\tFALSE\t/\tFALSE\t0\tsession\ts1\n", buf.String())
+
+	for _, format := range []CookieFormat{CookieFormatJSON, CookieFormatNetscape} {
+		var buf bytes.Buffer
+		require.NoError(t, jar.Export(&buf, format))
+		imported, err := NewCookieJar(CookieJarOptions{})
+		require.NoError(t, err)
+		require.NoError(t, imported.Import(&buf, format))
+		assert.Equal(t, jar.All(), imported.All(), format)
+
+		u, _ := url.Parse("https://docs.example.com/docs/intro")
+		assert.Equal(t, []*http.Cookie{{Name: "lang", Value: "en"}}, imported.Cookies(u))
+	}
+}
+
+func TestCookieJarImportErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Data      string
+		Format    CookieFormat
+		WantError string
+	}{
+		{Data: "example.com\tFALSE\t/\n", Format: CookieFormatNetscape, WantError: "line 1: expected 7 tab separated fields, got 3"},
+		{Data: "# comment\nexample.com\tFALSE\t/\tFALSE\tnever\ta\tb\n", Format: CookieFormatNetscape, WantError: "line 2: invalid expiry \"never\""},
+		{Data: `[{"name":"a"}]`, Format: CookieFormatJSON, WantError: "name and domain are required"},
+		{Data: `{`, Format: CookieFormatJSON, WantError: "unexpected EOF"},
+		{Data: "", Format: 7, WantError: "invalid cookie format 7"},
+	} {
+		jar, err := NewCookieJar(CookieJarOptions{})
+		require.NoError(t, err)
+		assert.ErrorContains(t, jar.Import(strings.NewReader(tc.Data), tc.Format), tc.WantError)
+	}
+}
+
+func TestCookieJarFile(t *testing.T) {
+	for _, format := range []CookieFormat{CookieFormatJSON, CookieFormatNetscape} {
+		t.Run(strconv.Itoa(int(format)), func(t *testing.T) {
+			opts := CookieJarOptions{File: filepath.Join(t.TempDir(), "cookies"), Format: format}
+			jar := newTestJar(t, opts)
+			require.NoError(t, jar.Save())
+
+			loaded, err := NewCookieJar(opts)
+			require.NoError(t, err)
+			assert.Equal(t, jar.All(), loaded.All())
+
+			require.NoError(t, os.WriteFile(opts.File, []byte("garbage"), 0o600))
+			_, err = NewCookieJar(opts)
+			assert.ErrorContains(t, err, opts.File)
+		})
+	}
+
+	_, err := NewCookieJar(CookieJarOptions{Format: 5})
+	assert.ErrorContains(t, err, "invalid format 5")
+	jar, err := NewCookieJar(CookieJarOptions{})
+	require.NoError(t, err)
+	assert.ErrorContains(t, jar.Save(), "no file to save to")
+}
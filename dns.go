@@ -0,0 +1,316 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+type IPFamily int
+
+const (
+	// IPFamilyAny dials addresses of both families racing them as in RFC 6555
+	// (happy eyeballs), starting with the family of the first resolved address.
+	IPFamilyAny IPFamily = iota
+	IPFamilyIPv4Only
+	IPFamilyIPv6Only
+	IPFamilyPreferIPv4
+	IPFamilyPreferIPv6
+)
+
+// DNSConfig controls how the client built by NewNetHTTPClient resolves host
+// names.
+//
+// Overrides maps "host" or "host:port" to IP addresses used instead of
+// resolving the host, like curl --resolve. ResolverAddress is the host:port of
+// a DNS server queried instead of the system resolver. CacheTTL keeps
+// resolved addresses in memory for that long, and NegativeTTL does the same
+// for "no such host" answers; record TTLs are not available from net.Resolver.
+// FallbackDelay is how long to wait before racing the other address family,
+// 300ms by default.
+type DNSConfig struct {
+	Overrides       map[string][]string
+	ResolverAddress string
+	CacheTTL        time.Duration
+	NegativeTTL     time.Duration
+	IPFamily        IPFamily
+	FallbackDelay   time.Duration
+}
+
+type dnsDialer struct {
+	dialer        *net.Dialer
+	overrides     map[string][]netip.Addr
+	lookup        func(ctx context.Context, host string) ([]netip.Addr, error)
+	family        IPFamily
+	fallbackDelay time.Duration
+	cache         *dnsCache
+}
+
+// newDialContext returns dialer.DialContext itself when cfg does not change
+// resolution.
+func newDialContext(dialer *net.Dialer, cfg DNSConfig) (func(ctx context.Context, network, address string) (net.Conn, error), error) {
+	if len(cfg.Overrides) == 0 && cfg.ResolverAddress == "" && cfg.CacheTTL <= 0 && cfg.NegativeTTL <= 0 && cfg.IPFamily == IPFamilyAny {
+		return dialer.DialContext, nil
+	}
+	d, err := newDNSDialer(dialer, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return d.DialContext, nil
+}
+
+func newDNSDialer(dialer *net.Dialer, cfg DNSConfig) (*dnsDialer, error) {
+	if cfg.IPFamily < IPFamilyAny || cfg.IPFamily > IPFamilyPreferIPv6 {
+		return nil, fmt.Errorf("dns config: invalid ip family %d", cfg.IPFamily)
+	}
+
+	d := &dnsDialer{
+		dialer:        dialer,
+		overrides:     make(map[string][]netip.Addr, len(cfg.Overrides)),
+		family:        cfg.IPFamily,
+		fallbackDelay: cfg.FallbackDelay,
+	}
+	if d.fallbackDelay <= 0 {
+		d.fallbackDelay = 300 * time.Millisecond
+	}
+	for host, addresses := range cfg.Overrides {
+		for _, address := range addresses {
+			addr, err := netip.ParseAddr(address)
+			if err != nil {
+				return nil, fmt.Errorf("dns config: override for %s: %w", host, err)
+			}
+			d.overrides[host] = append(d.overrides[host], addr.Unmap())
+		}
+	}
+
+	resolver := net.DefaultResolver
+	if cfg.ResolverAddress != "" {
+		if _, _, err := net.SplitHostPort(cfg.ResolverAddress); err != nil {
+			return nil, fmt.Errorf("dns config: resolver address: %w", err)
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, cfg.ResolverAddress)
+			},
+		}
+	}
+	d.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		return resolver.LookupNetIP(ctx, "ip", host)
+	}
+	if cfg.CacheTTL > 0 || cfg.NegativeTTL > 0 {
+		d.cache = &dnsCache{ttl: cfg.CacheTTL, negativeTTL: cfg.NegativeTTL, now: time.Now, entries: make(map[string]dnsCacheEntry)}
+	}
+	return d, nil
+}
+
+func (d *dnsDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := d.resolve(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+	primaries, fallbacks := d.partition(addrs)
+	if len(primaries) == 0 {
+		return nil, &net.DNSError{Err: "no addresses of the configured ip family", Name: host, IsNotFound: true}
+	}
+	return d.dialParallel(ctx, network, port, primaries, fallbacks)
+}
+
+func (d *dnsDialer) resolve(ctx context.Context, host, port string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr.Unmap()}, nil
+	}
+	if addrs, ok := d.overrides[net.JoinHostPort(host, port)]; ok {
+		return addrs, nil
+	}
+	if addrs, ok := d.overrides[host]; ok {
+		return addrs, nil
+	}
+	if d.cache == nil {
+		return d.lookupHost(ctx, host)
+	}
+	if addrs, err, ok := d.cache.get(host); ok {
+		return addrs, err
+	}
+	addrs, err := d.lookupHost(ctx, host)
+	d.cache.put(host, addrs, err)
+	return addrs, err
+}
+
+func (d *dnsDialer) lookupHost(ctx context.Context, host string) ([]netip.Addr, error) {
+	addrs, err := d.lookup(ctx, host)
+	for i := range addrs {
+		addrs[i] = addrs[i].Unmap()
+	}
+	return addrs, err
+}
+
+// partition splits addrs by family according to the configured preference.
+func (d *dnsDialer) partition(addrs []netip.Addr) (primaries, fallbacks []netip.Addr) {
+	var v4, v6 []netip.Addr
+	for _, addr := range addrs {
+		if addr.Is4() {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+	switch d.family {
+	case IPFamilyIPv4Only:
+		return v4, nil
+	case IPFamilyIPv6Only:
+		return v6, nil
+	case IPFamilyPreferIPv4:
+		if len(v4) == 0 {
+			return v6, nil
+		}
+		return v4, v6
+	case IPFamilyPreferIPv6:
+		if len(v6) == 0 {
+			return v4, nil
+		}
+		return v6, v4
+	}
+	if len(addrs) > 0 && addrs[0].Is6() {
+		return v6, v4
+	}
+	if len(v4) == 0 {
+		return v6, nil
+	}
+	return v4, v6
+}
+
+// dialParallel tries primaries in order, starting to try fallbacks in
+// parallel after fallbackDelay or as soon as primaries fail. The first
+// connection established wins.
+func (d *dnsDialer) dialParallel(ctx context.Context, network, port string, primaries, fallbacks []netip.Addr) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, port, primaries)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 2)
+	primaryFailed := make(chan struct{})
+	go func() {
+		conn, err := d.dialSerial(ctx, network, port, primaries)
+		if err != nil {
+			close(primaryFailed)
+		}
+		results <- result{conn: conn, err: err}
+	}()
+	go func() {
+		timer := time.NewTimer(d.fallbackDelay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-primaryFailed:
+		case <-ctx.Done():
+			results <- result{err: ctx.Err()}
+			return
+		}
+		conn, err := d.dialSerial(ctx, network, port, fallbacks)
+		results <- result{conn: conn, err: err}
+	}()
+
+	var firstErr error
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err == nil {
+			cancel()
+			if i == 0 {
+				// close a late connection of the other family
+				go func() {
+					if late := <-results; late.conn != nil {
+						late.conn.Close()
+					}
+				}()
+			}
+			return r.conn, nil
+		}
+		if firstErr == nil {
+			firstErr = r.err
+		}
+	}
+	return nil, firstErr
+}
+
+func (d *dnsDialer) dialSerial(ctx context.Context, network, port string, addrs []netip.Addr) (net.Conn, error) {
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("dial: no addresses")
+	}
+	return nil, firstErr
+}
+
+type dnsCacheEntry struct {
+	addrs   []netip.Addr
+	err     error
+	expires time.Time
+}
+
+type dnsCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+func (c *dnsCache) get(host string) ([]netip.Addr, error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[host]
+	if !ok {
+		return nil, nil, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, host)
+		return nil, nil, false
+	}
+	return entry.addrs, entry.err, true
+}
+
+// put caches addresses, and "no such host" errors. Other errors, timeouts
+// included, are not cached.
+func (c *dnsCache) put(host string, addrs []netip.Addr, err error) {
+	ttl := c.ttl
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return
+		}
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[host] = dnsCacheEntry{addrs: addrs, err: err, expires: c.now().Add(ttl)}
+}
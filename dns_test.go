@@ -0,0 +1,237 @@
+package httpoh
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDNSTestServer(t *testing.T) (*httptest.Server, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	t.Cleanup(server.Close)
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	return server, port
+}
+
+func TestDNSOverrides(t *testing.T) {
+	_, port := newDNSTestServer(t)
+
+	for _, tc := range []struct {
+		Name      string
+		DNS       DNSConfig
+		URL       string
+		WantBody  string
+		WantError string
+	}{
+		{
+			Name:     "host",
+			DNS:      DNSConfig{Overrides: map[string][]string{"service.test": {"192.0.2.1", "127.0.0.1"}}, IPFamily: IPFamilyIPv4Only},
+			URL:      "http://service.test:" + port + "/",
+			WantBody: "service.test:" + port,
+		},
+		{
+			Name:     "host and port",
+			DNS:      DNSConfig{Overrides: map[string][]string{"service.test:" + port: {"127.0.0.1"}}},
+			URL:      "http://service.test:" + port + "/",
+			WantBody: "service.test:" + port,
+		},
+		{
+			Name:      "other port is resolved",
+			DNS:       DNSConfig{Overrides: map[string][]string{"service.test:1": {"127.0.0.1"}}, NegativeTTL: time.Minute},
+			URL:       "http://service.test:" + port + "/",
+			WantError: "no such host",
+		},
+		{
+			Name:      "no address of family",
+			DNS:       DNSConfig{Overrides: map[string][]string{"service.test": {"127.0.0.1"}}, IPFamily: IPFamilyIPv6Only},
+			URL:       "http://service.test:" + port + "/",
+			WantError: "no addresses of the configured ip family",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			cfg := Config{DNS: tc.DNS, ConnectTimeout: time.Second}
+			if tc.Name == "host" {
+				// 192.0.2.1 is not routable, 127.0.0.1 is tried after it
+				cfg.ConnectTimeout = 100 * time.Millisecond
+			}
+			body, err := proxyGet(t, cfg, tc.URL)
+			if tc.WantError != "" {
+				assert.ErrorContains(t, err, tc.WantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.WantBody, body)
+		})
+	}
+}
+
+func TestDNSConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		DNS       DNSConfig
+		WantError string
+	}{
+		{DNS: DNSConfig{Overrides: map[string][]string{"service.test": {"WTF"}}}, WantError: "override for service.test"},
+		{DNS: DNSConfig{ResolverAddress: "127.0.0.1"}, WantError: "resolver address"},
+		{DNS: DNSConfig{IPFamily: 42}, WantError: "invalid ip family"},
+	} {
+		_, err := NewNetHTTPClient(Config{DNS: tc.DNS})
+		assert.ErrorContains(t, err, tc.WantError)
+	}
+}
+
+// startDNSServer answers A queries with 127.0.0.1 and AAAA queries with no
+// records, for any name.
+func startDNSServer(t *testing.T) (string, *atomic.Int32) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	var queries atomic.Int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			end := 12
+			for end < n && query[end] != 0 {
+				end += int(query[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(query[end-4:])
+			if qtype == 1 {
+				queries.Add(1)
+			}
+
+			resp := append([]byte{}, query[:2]...)
+			resp = append(resp, 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0)
+			resp = append(resp, query[12:end]...)
+			if qtype == 1 {
+				resp[7] = 1
+				resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 127, 0, 0, 1)
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String(), &queries
+}
+
+func TestDNSResolverAndCache(t *testing.T) {
+	_, port := newDNSTestServer(t)
+	resolverAddress, queries := startDNSServer(t)
+
+	cfg := Config{DNS: DNSConfig{ResolverAddress: resolverAddress, CacheTTL: time.Minute}}
+	httpClient, err := NewNetHTTPClient(cfg)
+	require.NoError(t, err)
+	client, newError := NewClientNative(cfg, httpClient)
+	require.NoError(t, newError)
+
+	for _, host := range []string{"a.test", "b.test", "a.test"} {
+		httpClient.CloseIdleConnections()
+		resp := &rawBodyResponse{}
+		require.NoError(t, client.PerformRequest(context.Background(), testGet("http://"+host+":"+port+"/"), resp))
+		assert.Equal(t, host+":"+port, resp.body)
+	}
+	assert.Equal(t, int32(2), queries.Load())
+}
+
+func TestDNSCache(t *testing.T) {
+	d, err := newDNSDialer(&net.Dialer{}, DNSConfig{CacheTTL: time.Minute, NegativeTTL: 10 * time.Second})
+	require.NoError(t, err)
+	clock := newFakeClock()
+	d.cache.now = clock.Now
+
+	lookups := map[string]int{}
+	d.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		lookups[host]++
+		switch host {
+		case "missing.test":
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		case "timeout.test":
+			return nil, &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+		}
+		return []netip.Addr{netip.MustParseAddr("::ffff:192.0.2.1")}, nil
+	}
+	resolve := func(host string) ([]netip.Addr, error) {
+		return d.resolve(context.Background(), host, "80")
+	}
+
+	for i := 0; i < 2; i++ {
+		addrs, err := resolve("found.test")
+		require.NoError(t, err)
+		assert.Equal(t, []netip.Addr{netip.MustParseAddr("192.0.2.1")}, addrs)
+		_, err = resolve("missing.test")
+		assert.Error(t, err)
+		_, err = resolve("timeout.test")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, map[string]int{"found.test": 1, "missing.test": 1, "timeout.test": 2}, lookups)
+
+	clock.Advance(10 * time.Second)
+	resolve("found.test")
+	resolve("missing.test")
+	assert.Equal(t, map[string]int{"found.test": 1, "missing.test": 2, "timeout.test": 2}, lookups)
+
+	clock.Advance(time.Minute)
+	resolve("found.test")
+	assert.Equal(t, 2, lookups["found.test"])
+}
+
+func TestDNSIPFamily(t *testing.T) {
+	v4a, v4b := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")
+	v6a, v6b := netip.MustParseAddr("2001:db8::1"), netip.MustParseAddr("2001:db8::2")
+	addrs := []netip.Addr{v6a, v4a, v6b, v4b}
+
+	for _, tc := range []struct {
+		Family        IPFamily
+		Addrs         []netip.Addr
+		WantPrimaries []netip.Addr
+		WantFallbacks []netip.Addr
+	}{
+		{Family: IPFamilyAny, Addrs: addrs, WantPrimaries: []netip.Addr{v6a, v6b}, WantFallbacks: []netip.Addr{v4a, v4b}},
+		{Family: IPFamilyAny, Addrs: []netip.Addr{v4a, v6a}, WantPrimaries: []netip.Addr{v4a}, WantFallbacks: []netip.Addr{v6a}},
+		{Family: IPFamilyIPv4Only, Addrs: addrs, WantPrimaries: []netip.Addr{v4a, v4b}},
+		{Family: IPFamilyIPv6Only, Addrs: addrs, WantPrimaries: []netip.Addr{v6a, v6b}},
+		{Family: IPFamilyPreferIPv4, Addrs: addrs, WantPrimaries: []netip.Addr{v4a, v4b}, WantFallbacks: []netip.Addr{v6a, v6b}},
+		{Family: IPFamilyPreferIPv4, Addrs: []netip.Addr{v6a}, WantPrimaries: []netip.Addr{v6a}},
+		{Family: IPFamilyPreferIPv6, Addrs: []netip.Addr{v4a, v6a}, WantPrimaries: []netip.Addr{v6a}, WantFallbacks: []netip.Addr{v4a}},
+	} {
+		d := &dnsDialer{family: tc.Family}
+		primaries, fallbacks := d.partition(tc.Addrs)
+		assert.Equal(t, tc.WantPrimaries, primaries, tc.Family)
+		assert.Equal(t, tc.WantFallbacks, fallbacks, tc.Family)
+	}
+}
+
+func TestDNSFallbackAfterPrimariesFail(t *testing.T) {
+	_, port := newDNSTestServer(t)
+	cfg := Config{DNS: DNSConfig{
+		Overrides:     map[string][]string{"service.test": {"::1", "127.0.0.1"}},
+		FallbackDelay: time.Minute,
+	}}
+
+	started := time.Now()
+	body, err := proxyGet(t, cfg, "http://service.test:"+port+"/")
+	require.NoError(t, err)
+	assert.Equal(t, "service.test:"+port, body)
+	assert.Less(t, time.Since(started), 10*time.Second)
+}
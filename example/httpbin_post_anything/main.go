@@ -2,11 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/mxpaul/httpoh"
@@ -14,38 +11,13 @@ import (
 
 type HTTPBinResponse struct {
 	Data    string            `json:"data,omitempty"`
+	JSON    AnythingPayload   `json:"json,omitempty"`
 	Origin  string            `json:"origin,omitempty"`
 	Headers map[string]string `json:"headers,omitempty"`
 }
 
-type AnythingRequest struct {
-	url  string
-	body string
-}
-
-func (req *AnythingRequest) URL() string    { return req.url }
-func (req *AnythingRequest) Method() string { return http.MethodPost }
-func (req *AnythingRequest) Headers() http.Header {
-	return http.Header{"content-type": []string{"text/plain"}}
-}
-func (req *AnythingRequest) Body() io.Reader {
-	return strings.NewReader(req.body)
-}
-
-type AnythingResponse struct {
-	Code     int
-	Response HTTPBinResponse
-}
-
-func (resp *AnythingResponse) ProcessResponse(r *http.Response) error {
-	resp.Code = r.StatusCode
-
-	err := json.NewDecoder(r.Body).Decode(&resp.Response)
-	if err != nil {
-		fmt.Errorf("%w: json parse error", err)
-	}
-
-	return nil
+type AnythingPayload struct {
+	Message string `json:"message,omitempty"`
 }
 
 func main() {
@@ -64,8 +36,11 @@ func main() {
 		panic(err)
 	}
 
-	req := &AnythingRequest{url: "http://httpbin.org/anything", body: `request data`}
-	resp := &AnythingResponse{}
+	req, err := httpoh.NewJSONRequest(http.MethodPost, "http://httpbin.org/anything", AnythingPayload{Message: "request data"})
+	if err != nil {
+		panic(err)
+	}
+	resp := &httpoh.JSONResponse[HTTPBinResponse]{}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
@@ -73,7 +48,9 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Response data: %v\n", resp.Response.Data)
-	fmt.Printf("Response headers: %v\n", resp.Response.Headers)
-	fmt.Printf("Response origin: %v\n", resp.Response.Origin)
+	fmt.Printf("Response code: %v\n", resp.StatusCode)
+	fmt.Printf("Response data: %v\n", resp.Data.Data)
+	fmt.Printf("Response json: %v\n", resp.Data.JSON.Message)
+	fmt.Printf("Response headers: %v\n", resp.Data.Headers)
+	fmt.Printf("Response origin: %v\n", resp.Data.Origin)
 }
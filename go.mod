@@ -5,6 +5,7 @@ go 1.22.1
 require (
 	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358
 	github.com/stretchr/testify v1.9.0
+	golang.org/x/net v0.24.0
 )
 
 require (
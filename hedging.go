@@ -0,0 +1,260 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+var errHedgeLost = errors.New("hedged attempt lost")
+
+const (
+	hedgeWindow     = 100
+	hedgeMinSamples = 20
+)
+
+type HedgingConfig struct {
+	Delay            time.Duration
+	Adaptive         bool
+	MinDelay         time.Duration
+	MaxDelay         time.Duration
+	MaxAttempts      int
+	HedgeSafeMethods bool
+}
+
+// HedgingClient is a Client decorator sending another attempt of a request
+// when the previous one has not completed within Delay, and keeping the
+// attempt completing first. The other attempts are cancelled as soon as one of
+// them gets to ProcessResponse, so it is called once. A failed attempt does
+// not complete the request while other attempts are in flight.
+//
+// Only requests marked with RequestOptions.Idempotent are hedged, and also
+// GET, HEAD and OPTIONS requests with HedgeSafeMethods. Requests with a
+// one-shot body are never hedged. MaxAttempts (2 by default) counts the first
+// attempt. With Adaptive, the delay is the 95th percentile of the latency of
+// recent successful requests, between MinDelay and MaxDelay, and Delay is used
+// until enough of them are seen.
+type HedgingClient struct {
+	Next             Client
+	Delay            time.Duration
+	Adaptive         bool
+	MinDelay         time.Duration
+	MaxDelay         time.Duration
+	MaxAttempts      int
+	HedgeSafeMethods bool
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	next      int
+}
+
+var _ Client = (*HedgingClient)(nil)
+
+func NewHedgingClient(cfg HedgingConfig, next Client) (*HedgingClient, error) {
+	if next == nil {
+		return nil, errors.New("hedging client: next client is nil")
+	}
+	if cfg.Delay <= 0 {
+		return nil, fmt.Errorf("hedging client: invalid delay %v", cfg.Delay)
+	}
+	if cfg.MaxAttempts < 0 || cfg.MaxAttempts == 1 {
+		return nil, fmt.Errorf("hedging client: invalid max attempts %d", cfg.MaxAttempts)
+	}
+	if cfg.MaxDelay > 0 && cfg.MaxDelay < cfg.MinDelay {
+		return nil, fmt.Errorf("hedging client: max delay %v is below min delay %v", cfg.MaxDelay, cfg.MinDelay)
+	}
+
+	c := &HedgingClient{
+		Next:             next,
+		Delay:            cfg.Delay,
+		Adaptive:         cfg.Adaptive,
+		MinDelay:         cfg.MinDelay,
+		MaxDelay:         cfg.MaxDelay,
+		MaxAttempts:      cfg.MaxAttempts,
+		HedgeSafeMethods: cfg.HedgeSafeMethods,
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = 2
+	}
+	return c, nil
+}
+
+func (c *HedgingClient) hedgeable(req Request) bool {
+	if !canResend(req) {
+		return false
+	}
+	if requestOptions(req).Idempotent {
+		return true
+	}
+	switch req.Method() {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return c.HedgeSafeMethods
+	}
+	return false
+}
+
+type hedgeResult struct {
+	attempt int
+	err     error
+	elapsed time.Duration
+}
+
+func (c *HedgingClient) PerformRequest(ctx context.Context, req Request, resp Response) error {
+	if !c.hedgeable(req) {
+		return c.Next.PerformRequest(ctx, req, resp)
+	}
+
+	// cancels the attempts still running when the request completes
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	state := &hedgeState{winner: -1}
+	results := make(chan hedgeResult, c.MaxAttempts)
+	start := func(attempt int) {
+		attemptCtx, attemptCancel := context.WithCancel(ctx)
+		state.addAttempt(attemptCancel)
+		go func() {
+			started := time.Now()
+			err := c.Next.PerformRequest(attemptCtx, req, &hedgeResponse{Response: resp, state: state, attempt: attempt})
+			results <- hedgeResult{attempt: attempt, err: err, elapsed: time.Since(started)}
+		}()
+	}
+
+	delay := c.delay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	start(0)
+	started, pending := 1, 1
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if ctx.Err() == nil && state.winnerAttempt() < 0 {
+				start(started)
+				started++
+				pending++
+			}
+			if started < c.MaxAttempts {
+				timer.Reset(delay)
+			}
+		case result := <-results:
+			pending--
+			if winner := state.winnerAttempt(); winner == result.attempt || (winner < 0 && result.err == nil && state.claim(result.attempt)) {
+				if result.err == nil {
+					c.observe(result.elapsed)
+				}
+				return result.err
+			}
+			if firstErr == nil && !errors.Is(result.err, errHedgeLost) {
+				firstErr = result.err
+			}
+			if pending == 0 && state.winnerAttempt() < 0 {
+				return firstErr
+			}
+		}
+	}
+}
+
+func (c *HedgingClient) delay() time.Duration {
+	if !c.Adaptive {
+		return c.Delay
+	}
+	c.mu.Lock()
+	if len(c.latencies) < hedgeMinSamples {
+		c.mu.Unlock()
+		return c.Delay
+	}
+	latencies := slices.Clone(c.latencies)
+	c.mu.Unlock()
+
+	slices.Sort(latencies)
+	delay := latencies[int(math.Ceil(0.95*float64(len(latencies))))-1]
+	if delay < c.MinDelay {
+		delay = c.MinDelay
+	}
+	if c.MaxDelay > 0 && delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+	return max(delay, time.Millisecond)
+}
+
+func (c *HedgingClient) observe(latency time.Duration) {
+	if !c.Adaptive {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.latencies) < hedgeWindow {
+		c.latencies = append(c.latencies, latency)
+		return
+	}
+	c.latencies[c.next] = latency
+	c.next = (c.next + 1) % hedgeWindow
+}
+
+// hedgeState elects the attempt allowed to process the response.
+type hedgeState struct {
+	mu      sync.Mutex
+	winner  int
+	cancels []context.CancelFunc
+}
+
+func (s *hedgeState) addAttempt(cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancels = append(s.cancels, cancel)
+}
+
+func (s *hedgeState) winnerAttempt() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.winner
+}
+
+// claim makes attempt the winner unless another one won already, and cancels
+// the other attempts.
+func (s *hedgeState) claim(attempt int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.winner >= 0 {
+		return s.winner == attempt
+	}
+	s.winner = attempt
+	for i, cancel := range s.cancels {
+		if i != attempt {
+			cancel()
+		}
+	}
+	return true
+}
+
+type hedgeResponse struct {
+	Response
+	state   *hedgeState
+	attempt int
+}
+
+func (r *hedgeResponse) ProcessResponse(netResp *http.Response) error {
+	if !r.state.claim(r.attempt) {
+		return errHedgeLost
+	}
+	return r.Response.ProcessResponse(netResp)
+}
+
+// SetTimings passes the timings of the winner only.
+func (r *hedgeResponse) SetTimings(t Timings) {
+	if r.state.winnerAttempt() != r.attempt {
+		return
+	}
+	if tResp, ok := findResponse[ResponseWithTimings](r.Response); ok {
+		tResp.SetTimings(t)
+	}
+}
+
+func (r *hedgeResponse) Unwrap() Response {
+	return r.Response
+}
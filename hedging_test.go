@@ -0,0 +1,312 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hedgeTestClient runs perform with the number of the attempt, from 0.
+type hedgeTestClient struct {
+	attempts atomic.Int32
+	perform  func(ctx context.Context, attempt int, resp Response) error
+}
+
+func (c *hedgeTestClient) PerformRequest(ctx context.Context, req Request, resp Response) error {
+	return c.perform(ctx, int(c.attempts.Add(1)-1), resp)
+}
+
+type countingResponse struct {
+	calls atomic.Int32
+	body  string
+}
+
+func (r *countingResponse) ProcessResponse(netResp *http.Response) error {
+	r.calls.Add(1)
+	body, err := io.ReadAll(netResp.Body)
+	r.body = string(body)
+	return err
+}
+
+func processBody(resp Response, body string) error {
+	return resp.ProcessResponse(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))})
+}
+
+type hedgeTestRequest struct {
+	*JSONRequest[string]
+	options RequestOptions
+}
+
+func (r *hedgeTestRequest) Options() RequestOptions { return r.options }
+
+// hedgeOneShotRequest has a body that can not be replayed.
+type hedgeOneShotRequest struct {
+	Request
+	options RequestOptions
+}
+
+func (r *hedgeOneShotRequest) Body() io.Reader         { return strings.NewReader("payload") }
+func (r *hedgeOneShotRequest) Options() RequestOptions { return r.options }
+
+func TestHedgingClientServer(t *testing.T) {
+	var requests atomic.Int32
+	loserCanceled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+				close(loserCanceled)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		io.WriteString(w, "fast")
+	}))
+	defer server.Close()
+
+	native, err := NewClientNative(Config{}, server.Client())
+	require.NoError(t, err)
+	client, err := NewHedgingClient(HedgingConfig{Delay: 20 * time.Millisecond, HedgeSafeMethods: true}, native)
+	require.NoError(t, err)
+
+	resp := &countingResponse{}
+	require.NoError(t, client.PerformRequest(context.Background(), testGet(server.URL), resp))
+	assert.Equal(t, "fast", resp.body)
+	assert.Equal(t, int32(1), resp.calls.Load())
+	select {
+	case <-loserCanceled:
+	case <-time.After(time.Second):
+		t.Fatal("slow attempt was not cancelled")
+	}
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestHedgingClientAttempts(t *testing.T) {
+	errFailed := errors.New("failed")
+	sleep := sleepContext
+	postReq, err := NewJSONRequest(http.MethodPost, "http://api.test/", "payload")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		Name         string
+		Config       HedgingConfig
+		Request      Request
+		Perform      func(ctx context.Context, attempt int, resp Response) error
+		WantErr      error
+		WantBody     string
+		WantAttempts int32
+	}{
+		{
+			Name:    "fast first attempt",
+			Config:  HedgingConfig{HedgeSafeMethods: true},
+			Request: testGet("http://api.test/"),
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				return processBody(resp, "first")
+			},
+			WantBody:     "first",
+			WantAttempts: 1,
+		},
+		{
+			Name:    "second attempt wins",
+			Config:  HedgingConfig{HedgeSafeMethods: true},
+			Request: testGet("http://api.test/"),
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				if attempt == 0 {
+					if err := sleep(ctx, time.Second); err != nil {
+						return err
+					}
+				}
+				return processBody(resp, []string{"first", "second"}[attempt])
+			},
+			WantBody:     "second",
+			WantAttempts: 2,
+		},
+		{
+			Name:    "three attempts",
+			Config:  HedgingConfig{MaxAttempts: 3, HedgeSafeMethods: true},
+			Request: testGet("http://api.test/"),
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				if attempt < 2 {
+					if err := sleep(ctx, time.Second); err != nil {
+						return err
+					}
+				}
+				return processBody(resp, "third")
+			},
+			WantBody:     "third",
+			WantAttempts: 3,
+		},
+		{
+			Name:    "failure waits for other attempt",
+			Config:  HedgingConfig{HedgeSafeMethods: true},
+			Request: testGet("http://api.test/"),
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				if attempt == 0 {
+					sleep(ctx, 30*time.Millisecond)
+					return errFailed
+				}
+				sleep(ctx, 30*time.Millisecond)
+				return processBody(resp, "second")
+			},
+			WantBody:     "second",
+			WantAttempts: 2,
+		},
+		{
+			Name:    "all attempts fail",
+			Config:  HedgingConfig{HedgeSafeMethods: true},
+			Request: testGet("http://api.test/"),
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				sleep(ctx, 30*time.Millisecond)
+				if attempt == 0 {
+					return errFailed
+				}
+				return errors.New("other")
+			},
+			WantErr:      errFailed,
+			WantAttempts: 2,
+		},
+		{
+			Name:    "failure before delay",
+			Config:  HedgingConfig{HedgeSafeMethods: true},
+			Request: testGet("http://api.test/"),
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				return errFailed
+			},
+			WantErr:      errFailed,
+			WantAttempts: 1,
+		},
+		{
+			Name:    "get not hedged by default",
+			Request: testGet("http://api.test/"),
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				sleep(ctx, 50*time.Millisecond)
+				return processBody(resp, "first")
+			},
+			WantBody:     "first",
+			WantAttempts: 1,
+		},
+		{
+			Name:    "post not hedged",
+			Config:  HedgingConfig{HedgeSafeMethods: true},
+			Request: postReq,
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				sleep(ctx, 50*time.Millisecond)
+				return processBody(resp, "first")
+			},
+			WantBody:     "first",
+			WantAttempts: 1,
+		},
+		{
+			Name:    "post marked idempotent",
+			Request: &hedgeTestRequest{JSONRequest: postReq, options: RequestOptions{Idempotent: true}},
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				if attempt == 0 {
+					if err := sleep(ctx, time.Second); err != nil {
+						return err
+					}
+				}
+				return processBody(resp, "second")
+			},
+			WantBody:     "second",
+			WantAttempts: 2,
+		},
+		{
+			Name:    "one-shot body not hedged",
+			Request: &hedgeOneShotRequest{Request: postReq, options: RequestOptions{Idempotent: true}},
+			Perform: func(ctx context.Context, attempt int, resp Response) error {
+				sleep(ctx, 50*time.Millisecond)
+				return processBody(resp, "first")
+			},
+			WantBody:     "first",
+			WantAttempts: 1,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Config.Delay = 10 * time.Millisecond
+			next := &hedgeTestClient{perform: tc.Perform}
+			client, err := NewHedgingClient(tc.Config, next)
+			require.NoError(t, err)
+
+			resp := &countingResponse{}
+			err = client.PerformRequest(context.Background(), tc.Request, resp)
+			assert.Equal(t, tc.WantAttempts, next.attempts.Load())
+			if tc.WantErr != nil {
+				assert.ErrorIs(t, err, tc.WantErr)
+				assert.Zero(t, resp.calls.Load())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.WantBody, resp.body)
+			assert.Equal(t, int32(1), resp.calls.Load())
+		})
+	}
+}
+
+func TestHedgingClientProcessResponseOnce(t *testing.T) {
+	release := make(chan struct{})
+	var lost atomic.Int32
+	next := &hedgeTestClient{perform: func(ctx context.Context, attempt int, resp Response) error {
+		if attempt == 0 {
+			time.AfterFunc(20*time.Millisecond, func() { close(release) })
+		}
+		<-release
+		err := processBody(resp, "body")
+		if errors.Is(err, errHedgeLost) {
+			lost.Add(1)
+		}
+		return err
+	}}
+	client, err := NewHedgingClient(HedgingConfig{Delay: time.Millisecond, MaxAttempts: 4, HedgeSafeMethods: true}, next)
+	require.NoError(t, err)
+
+	resp := &countingResponse{}
+	require.NoError(t, client.PerformRequest(context.Background(), testGet("http://api.test/"), resp))
+	assert.Equal(t, int32(1), resp.calls.Load())
+	assert.Eventually(t, func() bool { return lost.Load() == next.attempts.Load()-1 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(4), next.attempts.Load())
+}
+
+func TestHedgingClientAdaptiveDelay(t *testing.T) {
+	client, err := NewHedgingClient(HedgingConfig{Delay: time.Second, Adaptive: true}, successClient(t))
+	require.NoError(t, err)
+	for i := 1; i < hedgeMinSamples; i++ {
+		client.observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, time.Second, client.delay())
+
+	client.observe(20 * time.Millisecond)
+	assert.Equal(t, 19*time.Millisecond, client.delay())
+
+	client.MinDelay, client.MaxDelay = 50*time.Millisecond, time.Second
+	assert.Equal(t, 50*time.Millisecond, client.delay())
+	for i := 0; i < hedgeWindow; i++ {
+		client.observe(time.Minute)
+	}
+	assert.Len(t, client.latencies, hedgeWindow)
+	assert.Equal(t, time.Second, client.delay())
+}
+
+func TestNewHedgingClientErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Config    HedgingConfig
+		Next      Client
+		WantError string
+	}{
+		{Config: HedgingConfig{Delay: time.Second}, WantError: "next client is nil"},
+		{Config: HedgingConfig{}, Next: successClient(t), WantError: "invalid delay 0s"},
+		{Config: HedgingConfig{Delay: time.Second, MaxAttempts: 1}, Next: successClient(t), WantError: "invalid max attempts 1"},
+		{Config: HedgingConfig{Delay: time.Second, MinDelay: time.Second, MaxDelay: time.Millisecond}, Next: successClient(t), WantError: "max delay 1ms is below min delay 1s"},
+	} {
+		_, err := NewHedgingClient(tc.Config, tc.Next)
+		assert.ErrorContains(t, err, tc.WantError)
+	}
+}
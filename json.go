@@ -0,0 +1,96 @@
+package httpoh
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+var ErrUnexpectedContentType = errors.New("unexpected content type")
+
+// JSONRequest sends a payload marshaled to JSON. The body is marshaled once by
+// NewJSONRequest and may be resent on retries and redirects.
+type JSONRequest[T any] struct {
+	Header http.Header
+	method string
+	url    string
+	body   []byte
+}
+
+var (
+	_ RequestWithHeaders        = (*JSONRequest[any])(nil)
+	_ RequestWithBody           = (*JSONRequest[any])(nil)
+	_ RequestWithReplayableBody = (*JSONRequest[any])(nil)
+)
+
+func NewJSONRequest[T any](method, url string, payload T) (*JSONRequest[T], error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode json request: %w", err)
+	}
+	return &JSONRequest[T]{
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+			"Accept":       []string{"application/json"},
+		},
+		method: method,
+		url:    url,
+		body:   body,
+	}, nil
+}
+
+func (req *JSONRequest[T]) Method() string       { return req.method }
+func (req *JSONRequest[T]) URL() string          { return req.url }
+func (req *JSONRequest[T]) Headers() http.Header { return req.Header }
+func (req *JSONRequest[T]) Body() io.Reader      { return bytes.NewReader(req.body) }
+func (req *JSONRequest[T]) ContentLength() int64 { return int64(len(req.body)) }
+func (req *JSONRequest[T]) GetBody() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(req.body)), nil
+}
+
+// JSONResponse decodes a JSON response body into Data. Responses with a
+// Content-Type other than application/json or */*+json are rejected with
+// ErrUnexpectedContentType unless AnyContentType is set. Bodies of 204 No
+// Content and HEAD responses are not decoded.
+type JSONResponse[T any] struct {
+	StatusCode     int
+	Header         http.Header
+	Data           T
+	AnyContentType bool
+}
+
+var _ Response = (*JSONResponse[any])(nil)
+
+func (resp *JSONResponse[T]) ProcessResponse(r *http.Response) error {
+	resp.StatusCode = r.StatusCode
+	resp.Header = r.Header
+
+	if r.StatusCode == http.StatusNoContent || (r.Request != nil && r.Request.Method == http.MethodHead) {
+		return nil
+	}
+
+	if !resp.AnyContentType {
+		contentType := r.Header.Get("Content-Type")
+		if !isJSONContentType(contentType) {
+			return fmt.Errorf("%w: %q", ErrUnexpectedContentType, contentType)
+		}
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&resp.Data); err != nil {
+		return fmt.Errorf("decode json response: %w", err)
+	}
+	return nil
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,131 @@
+package httpoh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testJSONPayload struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestJSONRequestResponse(t *testing.T) {
+	for _, tc := range []struct {
+		Name           string
+		ServerHandler  http.Handler
+		AnyContentType bool
+		WantStatus     int
+		WantData       testJSONPayload
+		WantErrorMatch []string
+		WantErrorIs    error
+	}{
+		{
+			Name: "echo",
+			ServerHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				assert.Equal(t, "application/json", r.Header.Get("Accept"))
+				assert.Equal(t, "yes", r.Header.Get("X-Extra"))
+				assert.Equal(t, int64(len(`{"name":"in","count":1}`)), r.ContentLength)
+
+				var payload testJSONPayload
+				assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+				payload.Name = "out"
+				payload.Count++
+
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(payload)
+			}),
+			WantStatus: http.StatusCreated,
+			WantData:   testJSONPayload{Name: "out", Count: 2},
+		},
+		{
+			Name: "problem json",
+			ServerHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"name":"problem"}`))
+			}),
+			WantStatus: http.StatusBadRequest,
+			WantData:   testJSONPayload{Name: "problem"},
+		},
+		{
+			Name: "no content",
+			ServerHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}),
+			WantStatus: http.StatusNoContent,
+		},
+		{
+			Name: "unexpected content type",
+			ServerHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte(`<html></html>`))
+			}),
+			WantStatus:     http.StatusOK,
+			WantErrorIs:    ErrUnexpectedContentType,
+			WantErrorMatch: []string{"text/html"},
+		},
+		{
+			Name: "any content type",
+			ServerHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(`{"count":7}`))
+			}),
+			AnyContentType: true,
+			WantStatus:     http.StatusOK,
+			WantData:       testJSONPayload{Count: 7},
+		},
+		{
+			Name: "malformed json",
+			ServerHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"count":`))
+			}),
+			WantStatus:     http.StatusOK,
+			WantErrorMatch: []string{"decode json response"},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := httptest.NewServer(tc.ServerHandler)
+			defer server.Close()
+
+			client, newError := NewClientNative(Config{}, server.Client())
+			require.NoError(t, newError)
+
+			req, newError := NewJSONRequest(http.MethodPost, server.URL, testJSONPayload{Name: "in", Count: 1})
+			require.NoError(t, newError)
+			req.Header.Set("X-Extra", "yes")
+
+			resp := &JSONResponse[testJSONPayload]{AnyContentType: tc.AnyContentType}
+			gotError := client.PerformRequest(context.Background(), req, resp)
+
+			assert.Equal(t, tc.WantStatus, resp.StatusCode)
+			if tc.WantErrorMatch == nil {
+				assert.NoError(t, gotError)
+				assert.Equal(t, tc.WantData, resp.Data)
+			} else if assert.Error(t, gotError) {
+				for _, substr := range tc.WantErrorMatch {
+					assert.Contains(t, gotError.Error(), substr)
+				}
+				if tc.WantErrorIs != nil {
+					assert.True(t, errors.Is(gotError, tc.WantErrorIs))
+				}
+			}
+		})
+	}
+}
+
+func TestNewJSONRequestError(t *testing.T) {
+	_, gotError := NewJSONRequest(http.MethodPost, "http://example.invalid", map[string]any{"f": func() {}})
+	assert.ErrorContains(t, gotError, "encode json request")
+}
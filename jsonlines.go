@@ -0,0 +1,167 @@
+package httpoh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+var ErrLineTooLong = errors.New("line too long")
+
+const defaultMaxJSONLineSize = 1 << 20
+
+// JSONLinesError reports the line of a JSON Lines body that could not be
+// read or decoded, counting from 1.
+type JSONLinesError struct {
+	Line int
+	Err  error
+}
+
+func (e *JSONLinesError) Error() string {
+	return fmt.Sprintf("decode json lines: line %d: %v", e.Line, e.Err)
+}
+
+func (e *JSONLinesError) Unwrap() error {
+	return e.Err
+}
+
+// JSONLinesDecoder decodes a newline-delimited JSON stream one record at a
+// time, skipping blank lines. Lines longer than maxLineSize bytes, 1 MiB when
+// it is 0, fail with ErrLineTooLong. A typical use reads the body of
+// ClientNative.Stream:
+//
+//	for dec.Next() {
+//		handle(dec.Record())
+//	}
+//	if err := dec.Err(); err != nil {
+//		...
+//	}
+type JSONLinesDecoder[T any] struct {
+	scanner     *bufio.Scanner
+	maxLineSize int
+	line        int
+	record      T
+	err         error
+}
+
+func NewJSONLinesDecoder[T any](r io.Reader, maxLineSize int) *JSONLinesDecoder[T] {
+	if maxLineSize <= 0 {
+		maxLineSize = defaultMaxJSONLineSize
+	}
+	scanner := bufio.NewScanner(r)
+	// room for the line ending, longer lines are reported by Next
+	scanner.Buffer(make([]byte, 0, min(maxLineSize+2, 4096)), maxLineSize+2)
+	return &JSONLinesDecoder[T]{scanner: scanner, maxLineSize: maxLineSize}
+}
+
+// Next decodes the next record, returning false at the end of the stream or
+// on error.
+func (d *JSONLinesDecoder[T]) Next() bool {
+	if d.err != nil {
+		return false
+	}
+	for d.scanner.Scan() {
+		d.line++
+		line := d.scanner.Bytes()
+		if len(line) > d.maxLineSize {
+			d.err = &JSONLinesError{Line: d.line, Err: ErrLineTooLong}
+			return false
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record T
+		if err := json.Unmarshal(line, &record); err != nil {
+			d.err = &JSONLinesError{Line: d.line, Err: err}
+			return false
+		}
+		d.record = record
+		return true
+	}
+	if err := d.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = ErrLineTooLong
+		}
+		d.err = &JSONLinesError{Line: d.line + 1, Err: err}
+	}
+	return false
+}
+
+// Record returns the record decoded by the last call to Next.
+func (d *JSONLinesDecoder[T]) Record() T {
+	return d.record
+}
+
+// Line returns the line of the last record, counting from 1.
+func (d *JSONLinesDecoder[T]) Line() int {
+	return d.line
+}
+
+// Err returns the error stopping Next, nil at the end of the stream.
+func (d *JSONLinesDecoder[T]) Err() error {
+	return d.err
+}
+
+// JSONLinesResponse decodes a newline-delimited JSON body (NDJSON, JSON
+// Lines) record by record, passing each of them to OnRecord along with its
+// line number. An error from OnRecord stops decoding and is returned as is.
+// Responses with a Content-Type other than application/x-ndjson,
+// application/jsonl, application/x-jsonlines or a JSON one are rejected with
+// ErrUnexpectedContentType unless AnyContentType is set. MaxLineSize is
+// passed to NewJSONLinesDecoder. Records counts the records decoded.
+type JSONLinesResponse[T any] struct {
+	StatusCode     int
+	Header         http.Header
+	Records        int
+	OnRecord       func(line int, record T) error
+	MaxLineSize    int
+	AnyContentType bool
+}
+
+var _ Response = (*JSONLinesResponse[any])(nil)
+
+func (resp *JSONLinesResponse[T]) ProcessResponse(r *http.Response) error {
+	resp.StatusCode = r.StatusCode
+	resp.Header = r.Header
+	resp.Records = 0
+
+	if r.StatusCode == http.StatusNoContent || (r.Request != nil && r.Request.Method == http.MethodHead) {
+		return nil
+	}
+	if resp.OnRecord == nil {
+		return errors.New("json lines response: OnRecord is nil")
+	}
+
+	if !resp.AnyContentType {
+		contentType := r.Header.Get("Content-Type")
+		if !isJSONLinesContentType(contentType) {
+			return fmt.Errorf("%w: %q", ErrUnexpectedContentType, contentType)
+		}
+	}
+
+	dec := NewJSONLinesDecoder[T](r.Body, resp.MaxLineSize)
+	for dec.Next() {
+		resp.Records++
+		if err := resp.OnRecord(dec.Line(), dec.Record()); err != nil {
+			return err
+		}
+	}
+	return dec.Err()
+}
+
+func isJSONLinesContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return true
+	}
+	return isJSONContentType(contentType)
+}
@@ -0,0 +1,188 @@
+package httpoh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLinesDecoder(t *testing.T) {
+	for _, tc := range []struct {
+		Name        string
+		Body        string
+		MaxLineSize int
+		WantRecords []testJSONPayload
+		WantLines   []int
+		WantErr     string
+		WantErrIs   error
+		WantErrLine int
+	}{
+		{
+			Name:        "records",
+			Body:        "{\"name\":\"a\",\"count\":1}\n\n  \r\n{\"name\":\"b\"}\r\n{\"count\":3}",
+			WantRecords: []testJSONPayload{{Name: "a", Count: 1}, {Name: "b"}, {Count: 3}},
+			WantLines:   []int{1, 4, 5},
+		},
+		{
+			Name:        "decode error",
+			Body:        "{\"name\":\"a\"}\n\n{\"name\":\n{\"name\":\"c\"}\n",
+			WantRecords: []testJSONPayload{{Name: "a"}},
+			WantLines:   []int{1},
+			WantErr:     "decode json lines: line 3: unexpected end of JSON input",
+			WantErrLine: 3,
+		},
+		{
+			Name:        "several values on a line",
+			Body:        "{\"name\":\"a\"} {\"name\":\"b\"}\n",
+			WantErr:     "line 1: invalid character '{' after top-level value",
+			WantErrLine: 1,
+		},
+		{
+			Name:        "line at limit",
+			Body:        "{\"count\":1}\r\n{\"count\":22}\n",
+			MaxLineSize: len(`{"count":22}`),
+			WantRecords: []testJSONPayload{{Count: 1}, {Count: 22}},
+			WantLines:   []int{1, 2},
+		},
+		{
+			Name:        "line too long",
+			Body:        "{\"count\":1}\n{\"count\":333}\n{\"count\":1}\n",
+			MaxLineSize: len(`{"count":22}`),
+			WantRecords: []testJSONPayload{{Count: 1}},
+			WantLines:   []int{1},
+			WantErrIs:   ErrLineTooLong,
+			WantErrLine: 2,
+		},
+		{
+			Name:        "line exceeding buffer",
+			Body:        "{\"count\":1}\n{\"name\":\"" + strings.Repeat("x", 64) + "\"}\n",
+			MaxLineSize: 16,
+			WantRecords: []testJSONPayload{{Count: 1}},
+			WantLines:   []int{1},
+			WantErrIs:   ErrLineTooLong,
+			WantErrLine: 2,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			dec := NewJSONLinesDecoder[testJSONPayload](strings.NewReader(tc.Body), tc.MaxLineSize)
+			var records []testJSONPayload
+			var lines []int
+			for dec.Next() {
+				records = append(records, dec.Record())
+				lines = append(lines, dec.Line())
+			}
+			assert.Equal(t, tc.WantRecords, records)
+			assert.Equal(t, tc.WantLines, lines)
+			assert.False(t, dec.Next())
+
+			err := dec.Err()
+			if tc.WantErr == "" && tc.WantErrIs == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var linesErr *JSONLinesError
+			require.ErrorAs(t, err, &linesErr)
+			assert.Equal(t, tc.WantErrLine, linesErr.Line)
+			if tc.WantErr != "" {
+				assert.ErrorContains(t, err, tc.WantErr)
+			}
+			if tc.WantErrIs != nil {
+				assert.ErrorIs(t, err, tc.WantErrIs)
+			}
+		})
+	}
+}
+
+func TestJSONLinesResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		enc := json.NewEncoder(w)
+		for i := 1; i <= 3; i++ {
+			enc.Encode(testJSONPayload{Name: r.URL.Path, Count: i})
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+	client, err := NewClientNative(Config{}, server.Client())
+	require.NoError(t, err)
+	errStop := errors.New("stop")
+
+	for _, tc := range []struct {
+		Name           string
+		Path           string
+		AnyContentType bool
+		StopAt         int
+		WantCounts     []int
+		WantErrIs      error
+	}{
+		{Name: "all records", Path: "/items", WantCounts: []int{1, 2, 3}},
+		{Name: "callback error", Path: "/items", StopAt: 2, WantCounts: []int{1, 2}, WantErrIs: errStop},
+		{Name: "content type", Path: "/html", WantErrIs: ErrUnexpectedContentType},
+		{Name: "any content type", Path: "/html", AnyContentType: true, WantCounts: []int{1, 2, 3}},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var counts []int
+			resp := &JSONLinesResponse[testJSONPayload]{
+				AnyContentType: tc.AnyContentType,
+				OnRecord: func(line int, record testJSONPayload) error {
+					assert.Equal(t, tc.Path, record.Name)
+					assert.Equal(t, record.Count, line)
+					counts = append(counts, record.Count)
+					if record.Count == tc.StopAt {
+						return errStop
+					}
+					return nil
+				},
+			}
+			err := client.PerformRequest(context.Background(), testGet(server.URL+tc.Path), resp)
+			assert.Equal(t, tc.WantCounts, counts)
+			assert.Equal(t, len(tc.WantCounts), resp.Records)
+			if tc.WantErrIs != nil {
+				assert.ErrorIs(t, err, tc.WantErrIs)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+
+	err = client.PerformRequest(context.Background(), testGet(server.URL), &JSONLinesResponse[testJSONPayload]{})
+	assert.ErrorContains(t, err, "OnRecord is nil")
+}
+
+func TestJSONLinesDecoderStream(t *testing.T) {
+	next := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "{\"count\":1}\n")
+		w.(http.Flusher).Flush()
+		<-next
+		io.WriteString(w, "{\"count\":2}\n")
+	}))
+	defer server.Close()
+	client := newStreamTestClient(t)
+
+	stream, err := client.Stream(context.Background(), testGet(server.URL))
+	require.NoError(t, err)
+	defer stream.Close()
+	dec := NewJSONLinesDecoder[testJSONPayload](stream, 0)
+	require.True(t, dec.Next())
+	assert.Equal(t, testJSONPayload{Count: 1}, dec.Record())
+	close(next)
+	require.True(t, dec.Next())
+	assert.Equal(t, testJSONPayload{Count: 2}, dec.Record())
+	assert.False(t, dec.Next())
+	assert.NoError(t, dec.Err())
+}
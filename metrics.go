@@ -0,0 +1,34 @@
+package httpoh
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metrics receives measurements of every ClientNative.PerformRequest call.
+// The metrics subpackage has an implementation exposing them in Prometheus
+// text format.
+type Metrics interface {
+	RequestStarted(method, host string)
+	RequestFinished(m RequestMetrics)
+}
+
+// RequestMetrics describes a finished request. StatusCode is zero when no
+// response was received, ResponseSize counts body bytes actually read.
+type RequestMetrics struct {
+	Method       string
+	Host         string
+	StatusCode   int
+	Duration     time.Duration
+	ResponseSize int64
+	Err          error
+}
+
+// StatusClass groups status codes as "2xx", "4xx" and so on, or returns
+// "none" when there was no response.
+func (m RequestMetrics) StatusClass() string {
+	if m.StatusCode < 100 || m.StatusCode > 599 {
+		return "none"
+	}
+	return fmt.Sprintf("%dxx", m.StatusCode/100)
+}
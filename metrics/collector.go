@@ -0,0 +1,266 @@
+// Package metrics collects httpoh client metrics and exposes them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mxpaul/httpoh"
+)
+
+var (
+	DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	DefaultSizeBuckets     = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+)
+
+// Collector implements httpoh.Metrics. Request and error counters, duration
+// and response size histograms are labeled by method, host and status class,
+// the in-flight gauge by method and host. The zero value is ready to use with
+// the httpoh_client namespace and default buckets.
+type Collector struct {
+	Namespace       string
+	DurationBuckets []float64
+	SizeBuckets     []float64
+
+	mu        sync.Mutex
+	inFlight  map[inFlightKey]int64
+	requests  map[requestKey]int64
+	errors    map[requestKey]int64
+	durations map[requestKey]*histogram
+	sizes     map[requestKey]*histogram
+}
+
+var _ httpoh.Metrics = (*Collector)(nil)
+
+type inFlightKey struct {
+	method, host string
+}
+
+type requestKey struct {
+	method, host, statusClass string
+}
+
+const defaultNamespace = "httpoh_client"
+
+func NewCollector(namespace string) *Collector {
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+	c := &Collector{
+		Namespace:       namespace,
+		DurationBuckets: DefaultDurationBuckets,
+		SizeBuckets:     DefaultSizeBuckets,
+	}
+	c.init()
+	return c
+}
+
+// init makes the maps of a zero value Collector, c.mu must be held.
+func (c *Collector) init() {
+	if c.inFlight != nil {
+		return
+	}
+	c.inFlight = make(map[inFlightKey]int64)
+	c.requests = make(map[requestKey]int64)
+	c.errors = make(map[requestKey]int64)
+	c.durations = make(map[requestKey]*histogram)
+	c.sizes = make(map[requestKey]*histogram)
+}
+
+func (c *Collector) namespace() string {
+	if c.Namespace == "" {
+		return defaultNamespace
+	}
+	return c.Namespace
+}
+
+func (c *Collector) RequestStarted(method, host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+	c.inFlight[inFlightKey{method: method, host: host}]++
+}
+
+func (c *Collector) RequestFinished(m httpoh.RequestMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.init()
+
+	c.inFlight[inFlightKey{method: m.Method, host: m.Host}]--
+
+	key := requestKey{method: m.Method, host: m.Host, statusClass: m.StatusClass()}
+	c.requests[key]++
+	if m.Err != nil {
+		c.errors[key]++
+	}
+	if c.durations[key] == nil {
+		c.durations[key] = newHistogram(bucketsOrDefault(c.DurationBuckets, DefaultDurationBuckets))
+	}
+	c.durations[key].observe(m.Duration.Seconds())
+	if m.StatusCode != 0 {
+		if c.sizes[key] == nil {
+			c.sizes[key] = newHistogram(bucketsOrDefault(c.SizeBuckets, DefaultSizeBuckets))
+		}
+		c.sizes[key].observe(float64(m.ResponseSize))
+	}
+}
+
+// Handler serves collected metrics in the Prometheus text format.
+func (c *Collector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.WriteTo(w)
+	})
+}
+
+// WriteTo writes collected metrics in the Prometheus text format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	c.writeCounter(cw, "requests_total", "Number of finished requests.", c.requests)
+	c.writeCounter(cw, "request_errors_total", "Number of requests finished with an error.", c.errors)
+	c.writeInFlight(cw)
+	c.writeHistogram(cw, "request_duration_seconds", "Request duration including response processing.", c.durations)
+	c.writeHistogram(cw, "response_size_bytes", "Response body bytes read.", c.sizes)
+	if err := cw.w.Flush(); err != nil && cw.err == nil {
+		cw.err = err
+	}
+	return cw.n, cw.err
+}
+
+func (c *Collector) writeCounter(w io.Writer, name, help string, values map[requestKey]int64) {
+	name = c.namespace() + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedRequestKeys(values) {
+		fmt.Fprintf(w, "%s%s %d\n", name, key.labels(), values[key])
+	}
+}
+
+func (c *Collector) writeInFlight(w io.Writer) {
+	name := c.namespace() + "_requests_in_flight"
+	fmt.Fprintf(w, "# HELP %s Number of requests being performed.\n# TYPE %s gauge\n", name, name)
+	keys := make([]inFlightKey, 0, len(c.inFlight))
+	for key := range c.inFlight {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].host < keys[j].host
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %d\n", name, formatLabels("host", key.host, "method", key.method), c.inFlight[key])
+	}
+}
+
+func (c *Collector) writeHistogram(w io.Writer, name, help string, values map[requestKey]*histogram) {
+	name = c.namespace() + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, key := range sortedRequestKeys(values) {
+		h := values[key]
+		var cumulative int64
+		for i, upper := range h.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, key.labels("le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, key.labels("le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, key.labels(), formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, key.labels(), h.count)
+	}
+}
+
+func (key requestKey) labels(extra ...string) string {
+	return formatLabels(append([]string{"host", key.host, "method", key.method, "status_class", key.statusClass}, extra...)...)
+}
+
+func sortedRequestKeys[V any](values map[requestKey]V) []requestKey {
+	keys := make([]requestKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.statusClass < b.statusClass
+	})
+	return keys
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, pairs[i], labelValueEscaper.Replace(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []int64
+	count   int64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+func bucketsOrDefault(buckets, defaults []float64) []float64 {
+	if buckets == nil {
+		return defaults
+	}
+	return buckets
+}
+
+func (h *histogram) observe(v float64) {
+	h.count++
+	h.sum += v
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
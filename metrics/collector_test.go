@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpaul/httpoh"
+)
+
+func TestCollectorPerformRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	stopped := httptest.NewServer(http.NotFoundHandler())
+	stopped.Close()
+	stoppedHost := strings.TrimPrefix(stopped.URL, "http://")
+
+	collector := NewCollector("")
+	client, newError := httpoh.NewClientNative(httpoh.Config{CheckStatus: true}, server.Client())
+	require.NoError(t, newError)
+	client.Metrics = collector
+
+	for _, url := range []string{server.URL + "/ok", server.URL + "/ok", server.URL + "/fail", stopped.URL} {
+		req := httpoh.NewMockRequest(t)
+		req.EXPECT().URL().Return(url)
+		req.EXPECT().Method().Return(http.MethodGet)
+
+		resp := httpoh.NewMockResponse(t)
+		resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+			_, err := io.Copy(io.Discard, r.Body)
+			return err
+		}).Maybe()
+
+		client.PerformRequest(context.Background(), req, resp)
+	}
+
+	scrape := httptest.NewServer(collector.Handler())
+	defer scrape.Close()
+	scrapeResp, err := http.Get(scrape.URL)
+	require.NoError(t, err)
+	defer scrapeResp.Body.Close()
+	assert.Contains(t, scrapeResp.Header.Get("Content-Type"), "text/plain")
+	body, err := io.ReadAll(scrapeResp.Body)
+	require.NoError(t, err)
+	exposition := string(body)
+
+	for _, line := range []string{
+		"# TYPE httpoh_client_requests_total counter",
+		`httpoh_client_requests_total{host="` + host + `",method="GET",status_class="2xx"} 2`,
+		`httpoh_client_requests_total{host="` + host + `",method="GET",status_class="5xx"} 1`,
+		`httpoh_client_requests_total{host="` + stoppedHost + `",method="GET",status_class="none"} 1`,
+		`httpoh_client_request_errors_total{host="` + host + `",method="GET",status_class="5xx"} 1`,
+		`httpoh_client_request_errors_total{host="` + stoppedHost + `",method="GET",status_class="none"} 1`,
+		"# TYPE httpoh_client_requests_in_flight gauge",
+		`httpoh_client_requests_in_flight{host="` + host + `",method="GET"} 0`,
+		"# TYPE httpoh_client_request_duration_seconds histogram",
+		`httpoh_client_request_duration_seconds_count{host="` + host + `",method="GET",status_class="2xx"} 2`,
+		`httpoh_client_request_duration_seconds_bucket{host="` + host + `",method="GET",status_class="2xx",le="+Inf"} 2`,
+		"# TYPE httpoh_client_response_size_bytes histogram",
+		`httpoh_client_response_size_bytes_bucket{host="` + host + `",method="GET",status_class="2xx",le="256"} 2`,
+		`httpoh_client_response_size_bytes_sum{host="` + host + `",method="GET",status_class="2xx"} 20`,
+	} {
+		assert.Contains(t, exposition, line+"\n")
+	}
+	assert.NotContains(t, exposition, `httpoh_client_response_size_bytes_count{host="`+stoppedHost)
+}
+
+func TestCollectorHistogram(t *testing.T) {
+	collector := NewCollector("test")
+	collector.DurationBuckets = []float64{0.1, 1}
+	collector.SizeBuckets = []float64{1024}
+	for _, d := range []time.Duration{50 * time.Millisecond, 500 * time.Millisecond, 2 * time.Second} {
+		collector.RequestStarted(http.MethodPost, "a\"b")
+		collector.RequestFinished(httpoh.RequestMetrics{
+			Method:     http.MethodPost,
+			Host:       "a\"b",
+			StatusCode: http.StatusCreated,
+			Duration:   d,
+			Err:        errors.New("WTF"),
+		})
+	}
+	collector.RequestStarted(http.MethodPost, "a\"b")
+
+	var b strings.Builder
+	_, err := collector.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP test_requests_total Number of finished requests.
+# TYPE test_requests_total counter
+test_requests_total{host="a\"b",method="POST",status_class="2xx"} 3
+# HELP test_request_errors_total Number of requests finished with an error.
+# TYPE test_request_errors_total counter
+test_request_errors_total{host="a\"b",method="POST",status_class="2xx"} 3
+# HELP test_requests_in_flight Number of requests being performed.
+# TYPE test_requests_in_flight gauge
+test_requests_in_flight{host="a\"b",method="POST"} 1
+# HELP test_request_duration_seconds Request duration including response processing.
+# TYPE test_request_duration_seconds histogram
+test_request_duration_seconds_bucket{host="a\"b",method="POST",status_class="2xx",le="0.1"} 1
+test_request_duration_seconds_bucket{host="a\"b",method="POST",status_class="2xx",le="1"} 2
+test_request_duration_seconds_bucket{host="a\"b",method="POST",status_class="2xx",le="+Inf"} 3
+test_request_duration_seconds_sum{host="a\"b",method="POST",status_class="2xx"} 2.55
+test_request_duration_seconds_count{host="a\"b",method="POST",status_class="2xx"} 3
+# HELP test_response_size_bytes Response body bytes read.
+# TYPE test_response_size_bytes histogram
+test_response_size_bytes_bucket{host="a\"b",method="POST",status_class="2xx",le="1024"} 3
+test_response_size_bytes_bucket{host="a\"b",method="POST",status_class="2xx",le="+Inf"} 3
+test_response_size_bytes_sum{host="a\"b",method="POST",status_class="2xx"} 0
+test_response_size_bytes_count{host="a\"b",method="POST",status_class="2xx"} 3
+`, b.String())
+}
+
+func TestCollectorZeroValue(t *testing.T) {
+	var collector Collector
+	collector.RequestStarted(http.MethodGet, "a")
+	collector.RequestFinished(httpoh.RequestMetrics{Method: http.MethodGet, Host: "a", StatusCode: http.StatusOK, Duration: 2 * time.Millisecond})
+
+	var b strings.Builder
+	_, err := collector.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Contains(t, b.String(), `httpoh_client_requests_total{host="a",method="GET",status_class="2xx"} 1`)
+	assert.Contains(t, b.String(), `httpoh_client_request_duration_seconds_bucket{host="a",method="GET",status_class="2xx",le="0.005"} 1`)
+	assert.Contains(t, b.String(), `httpoh_client_response_size_bytes_bucket{host="a",method="GET",status_class="2xx",le="256"} 1`)
+}
+
+func TestStatusClass(t *testing.T) {
+	for code, want := range map[int]string{0: "none", 101: "1xx", 204: "2xx", 302: "3xx", 404: "4xx", 503: "5xx", 999: "none"} {
+		assert.Equal(t, want, httpoh.RequestMetrics{StatusCode: code}.StatusClass())
+	}
+}
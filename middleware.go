@@ -0,0 +1,55 @@
+package httpoh
+
+import (
+	"net/http"
+	"sync"
+)
+
+// RoundTripperFunc adapts an ordinary function to http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Middleware wraps the step of ClientNative.PerformRequest sending a fully
+// built *http.Request. The request passed to a middleware already has the
+// method, URL, body and all headers (User-Agent included) set, and it may
+// be modified before calling next. The response is seen before
+// Response.ProcessResponse is called.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Use appends middlewares to the client chain. The first middleware added is
+// the outermost one: it sees the request first and the response last.
+func (c *ClientNative) Use(mws ...Middleware) {
+	c.Middlewares = append(c.Middlewares, mws...)
+	c.chain = &clientChain{}
+}
+
+// clientChain is the round tripper of a ClientNative, built with its
+// middlewares and authenticator on the first request.
+type clientChain struct {
+	once sync.Once
+	rt   http.RoundTripper
+}
+
+func (c *ClientNative) roundTripper() http.RoundTripper {
+	if c.chain == nil {
+		return c.buildRoundTripper()
+	}
+	c.chain.once.Do(func() { c.chain.rt = c.buildRoundTripper() })
+	return c.chain.rt
+}
+
+func (c *ClientNative) buildRoundTripper() http.RoundTripper {
+	var rt http.RoundTripper = RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return c.HTTP.Do(r)
+	})
+	if c.Authenticator != nil {
+		rt = c.Authenticator.Wrap(rt)
+	}
+	for i := len(c.Middlewares) - 1; i >= 0; i-- {
+		rt = c.Middlewares[i](rt)
+	}
+	return rt
+}
@@ -0,0 +1,206 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func recordingMiddleware(name string, log *[]string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			*log = append(*log, name+" request")
+			resp, err := next.RoundTrip(r)
+			*log = append(*log, name+" response")
+			return resp, err
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var log []string
+	client, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client.Use(recordingMiddleware("first", &log), recordingMiddleware("second", &log))
+	client.Use(recordingMiddleware("third", &log))
+
+	req := NewMockRequest(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodGet)
+
+	resp := NewMockResponse(t)
+	resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+		log = append(log, "process response")
+		return nil
+	})
+
+	gotError := client.PerformRequest(context.Background(), req, resp)
+	assert.NoError(t, gotError)
+	assert.Equal(t, []string{
+		"first request",
+		"second request",
+		"third request",
+		"third response",
+		"second response",
+		"first response",
+		"process response",
+	}, log)
+}
+
+func TestMiddlewareChainBuiltOnce(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var log []string
+	wraps := 0
+	client, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client.Use(func(next http.RoundTripper) http.RoundTripper {
+		wraps++
+		return next
+	})
+	get := func() {
+		require.NoError(t, client.PerformRequest(context.Background(), testGet(server.URL), &testResponse{}))
+	}
+
+	get()
+	get()
+	assert.Equal(t, 1, wraps)
+
+	// Use rebuilds the chain with the new middleware
+	client.Use(recordingMiddleware("added", &log))
+	get()
+	get()
+	assert.Equal(t, 2, wraps)
+	assert.Equal(t, []string{"added request", "added response", "added request", "added response"}, log)
+}
+
+func TestMiddlewareSeesFinalHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		Name           string
+		Config         Config
+		RequestHeaders http.Header
+		WantUserAgent  string
+	}{
+		{
+			Name:          "config user agent",
+			Config:        Config{UserAgent: "UA"},
+			WantUserAgent: "UA",
+		},
+		{
+			Name:          "default user agent",
+			WantUserAgent: defaultUserAgent(),
+		},
+		{
+			Name:           "request overrides user agent",
+			Config:         Config{UserAgent: "UA"},
+			RequestHeaders: http.Header{"User-Agent": []string{"request UA"}},
+			WantUserAgent:  "request UA",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tc.WantUserAgent, r.Header.Get("User-Agent"))
+				assert.Equal(t, "injected", r.Header.Get("X-Injected"))
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			client, newError := NewClientNative(tc.Config, server.Client())
+			require.NoError(t, newError)
+			client.Use(func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					assert.Equal(t, []string{tc.WantUserAgent}, r.Header.Values("User-Agent"))
+					r.Header.Set("X-Injected", "injected")
+					return next.RoundTrip(r)
+				})
+			})
+
+			req := NewMockRequestWithHeaders(t)
+			req.EXPECT().URL().Return(server.URL)
+			req.EXPECT().Method().Return(http.MethodGet)
+			req.EXPECT().Headers().Return(tc.RequestHeaders)
+
+			resp := NewMockResponse(t)
+			resp.EXPECT().ProcessResponse(mock.Anything).Return(nil)
+
+			gotError := client.PerformRequest(context.Background(), req, resp)
+			assert.NoError(t, gotError)
+		})
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	for _, tc := range []struct {
+		Name           string
+		Middleware     Middleware
+		WantBody       string
+		WantErrorMatch []string
+	}{
+		{
+			Name: "synthetic response",
+			Middleware: func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusTeapot,
+						Body:       io.NopCloser(strings.NewReader("cached")),
+						Request:    r,
+					}, nil
+				})
+			},
+			WantBody: "cached",
+		},
+		{
+			Name: "error",
+			Middleware: func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+					return nil, errors.New("WTF")
+				})
+			},
+			WantErrorMatch: []string{"WTF"},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			client, newError := NewClientNative(Config{}, http.DefaultClient)
+			require.NoError(t, newError)
+			client.Use(tc.Middleware)
+
+			req := NewMockRequest(t)
+			req.EXPECT().URL().Return("http://example.invalid/")
+			req.EXPECT().Method().Return(http.MethodGet)
+
+			resp := NewMockResponse(t)
+			if tc.WantErrorMatch == nil {
+				resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+					body, _ := io.ReadAll(r.Body)
+					assert.Equal(t, tc.WantBody, string(body))
+					return nil
+				})
+			}
+
+			gotError := client.PerformRequest(context.Background(), req, resp)
+			if tc.WantErrorMatch == nil {
+				assert.NoError(t, gotError)
+			} else if assert.Error(t, gotError) {
+				for _, substr := range tc.WantErrorMatch {
+					assert.Contains(t, gotError.Error(), substr)
+				}
+			}
+		})
+	}
+}
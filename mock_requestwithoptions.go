@@ -0,0 +1,167 @@
+// Code generated by mockery. DO NOT EDIT.
+
+package httpoh
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockRequestWithOptions is an autogenerated mock type for the RequestWithOptions type
+type MockRequestWithOptions struct {
+	mock.Mock
+}
+
+type MockRequestWithOptions_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockRequestWithOptions) EXPECT() *MockRequestWithOptions_Expecter {
+	return &MockRequestWithOptions_Expecter{mock: &_m.Mock}
+}
+
+// Method provides a mock function with given fields:
+func (_m *MockRequestWithOptions) Method() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Method")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockRequestWithOptions_Method_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Method'
+type MockRequestWithOptions_Method_Call struct {
+	*mock.Call
+}
+
+// Method is a helper method to define mock.On call
+func (_e *MockRequestWithOptions_Expecter) Method() *MockRequestWithOptions_Method_Call {
+	return &MockRequestWithOptions_Method_Call{Call: _e.mock.On("Method")}
+}
+
+func (_c *MockRequestWithOptions_Method_Call) Run(run func()) *MockRequestWithOptions_Method_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithOptions_Method_Call) Return(_a0 string) *MockRequestWithOptions_Method_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithOptions_Method_Call) RunAndReturn(run func() string) *MockRequestWithOptions_Method_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Options provides a mock function with given fields:
+func (_m *MockRequestWithOptions) Options() RequestOptions {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Options")
+	}
+
+	var r0 RequestOptions
+	if rf, ok := ret.Get(0).(func() RequestOptions); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(RequestOptions)
+	}
+
+	return r0
+}
+
+// MockRequestWithOptions_Options_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Options'
+type MockRequestWithOptions_Options_Call struct {
+	*mock.Call
+}
+
+// Options is a helper method to define mock.On call
+func (_e *MockRequestWithOptions_Expecter) Options() *MockRequestWithOptions_Options_Call {
+	return &MockRequestWithOptions_Options_Call{Call: _e.mock.On("Options")}
+}
+
+func (_c *MockRequestWithOptions_Options_Call) Run(run func()) *MockRequestWithOptions_Options_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithOptions_Options_Call) Return(_a0 RequestOptions) *MockRequestWithOptions_Options_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithOptions_Options_Call) RunAndReturn(run func() RequestOptions) *MockRequestWithOptions_Options_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// URL provides a mock function with given fields:
+func (_m *MockRequestWithOptions) URL() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for URL")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockRequestWithOptions_URL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'URL'
+type MockRequestWithOptions_URL_Call struct {
+	*mock.Call
+}
+
+// URL is a helper method to define mock.On call
+func (_e *MockRequestWithOptions_Expecter) URL() *MockRequestWithOptions_URL_Call {
+	return &MockRequestWithOptions_URL_Call{Call: _e.mock.On("URL")}
+}
+
+func (_c *MockRequestWithOptions_URL_Call) Run(run func()) *MockRequestWithOptions_URL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithOptions_URL_Call) Return(_a0 string) *MockRequestWithOptions_URL_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithOptions_URL_Call) RunAndReturn(run func() string) *MockRequestWithOptions_URL_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockRequestWithOptions creates a new instance of MockRequestWithOptions. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockRequestWithOptions(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockRequestWithOptions {
+	mock := &MockRequestWithOptions{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,228 @@
+// Code generated by mockery. DO NOT EDIT.
+
+package httpoh
+
+import (
+	io "io"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockRequestWithReplayableBody is an autogenerated mock type for the RequestWithReplayableBody type
+type MockRequestWithReplayableBody struct {
+	mock.Mock
+}
+
+type MockRequestWithReplayableBody_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockRequestWithReplayableBody) EXPECT() *MockRequestWithReplayableBody_Expecter {
+	return &MockRequestWithReplayableBody_Expecter{mock: &_m.Mock}
+}
+
+// ContentLength provides a mock function with given fields:
+func (_m *MockRequestWithReplayableBody) ContentLength() int64 {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for ContentLength")
+	}
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	return r0
+}
+
+// MockRequestWithReplayableBody_ContentLength_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ContentLength'
+type MockRequestWithReplayableBody_ContentLength_Call struct {
+	*mock.Call
+}
+
+// ContentLength is a helper method to define mock.On call
+func (_e *MockRequestWithReplayableBody_Expecter) ContentLength() *MockRequestWithReplayableBody_ContentLength_Call {
+	return &MockRequestWithReplayableBody_ContentLength_Call{Call: _e.mock.On("ContentLength")}
+}
+
+func (_c *MockRequestWithReplayableBody_ContentLength_Call) Run(run func()) *MockRequestWithReplayableBody_ContentLength_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithReplayableBody_ContentLength_Call) Return(_a0 int64) *MockRequestWithReplayableBody_ContentLength_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithReplayableBody_ContentLength_Call) RunAndReturn(run func() int64) *MockRequestWithReplayableBody_ContentLength_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// GetBody provides a mock function with given fields:
+func (_m *MockRequestWithReplayableBody) GetBody() (io.ReadCloser, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetBody")
+	}
+
+	var r0 io.ReadCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func() (io.ReadCloser, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() io.ReadCloser); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockRequestWithReplayableBody_GetBody_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetBody'
+type MockRequestWithReplayableBody_GetBody_Call struct {
+	*mock.Call
+}
+
+// GetBody is a helper method to define mock.On call
+func (_e *MockRequestWithReplayableBody_Expecter) GetBody() *MockRequestWithReplayableBody_GetBody_Call {
+	return &MockRequestWithReplayableBody_GetBody_Call{Call: _e.mock.On("GetBody")}
+}
+
+func (_c *MockRequestWithReplayableBody_GetBody_Call) Run(run func()) *MockRequestWithReplayableBody_GetBody_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithReplayableBody_GetBody_Call) Return(_a0 io.ReadCloser, _a1 error) *MockRequestWithReplayableBody_GetBody_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockRequestWithReplayableBody_GetBody_Call) RunAndReturn(run func() (io.ReadCloser, error)) *MockRequestWithReplayableBody_GetBody_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Method provides a mock function with given fields:
+func (_m *MockRequestWithReplayableBody) Method() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Method")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockRequestWithReplayableBody_Method_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Method'
+type MockRequestWithReplayableBody_Method_Call struct {
+	*mock.Call
+}
+
+// Method is a helper method to define mock.On call
+func (_e *MockRequestWithReplayableBody_Expecter) Method() *MockRequestWithReplayableBody_Method_Call {
+	return &MockRequestWithReplayableBody_Method_Call{Call: _e.mock.On("Method")}
+}
+
+func (_c *MockRequestWithReplayableBody_Method_Call) Run(run func()) *MockRequestWithReplayableBody_Method_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithReplayableBody_Method_Call) Return(_a0 string) *MockRequestWithReplayableBody_Method_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithReplayableBody_Method_Call) RunAndReturn(run func() string) *MockRequestWithReplayableBody_Method_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// URL provides a mock function with given fields:
+func (_m *MockRequestWithReplayableBody) URL() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for URL")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockRequestWithReplayableBody_URL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'URL'
+type MockRequestWithReplayableBody_URL_Call struct {
+	*mock.Call
+}
+
+// URL is a helper method to define mock.On call
+func (_e *MockRequestWithReplayableBody_Expecter) URL() *MockRequestWithReplayableBody_URL_Call {
+	return &MockRequestWithReplayableBody_URL_Call{Call: _e.mock.On("URL")}
+}
+
+func (_c *MockRequestWithReplayableBody_URL_Call) Run(run func()) *MockRequestWithReplayableBody_URL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithReplayableBody_URL_Call) Return(_a0 string) *MockRequestWithReplayableBody_URL_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithReplayableBody_URL_Call) RunAndReturn(run func() string) *MockRequestWithReplayableBody_URL_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockRequestWithReplayableBody creates a new instance of MockRequestWithReplayableBody. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockRequestWithReplayableBody(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockRequestWithReplayableBody {
+	mock := &MockRequestWithReplayableBody{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -0,0 +1,167 @@
+// Code generated by mockery. DO NOT EDIT.
+
+package httpoh
+
+import mock "github.com/stretchr/testify/mock"
+
+// MockRequestWithURLTemplate is an autogenerated mock type for the RequestWithURLTemplate type
+type MockRequestWithURLTemplate struct {
+	mock.Mock
+}
+
+type MockRequestWithURLTemplate_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockRequestWithURLTemplate) EXPECT() *MockRequestWithURLTemplate_Expecter {
+	return &MockRequestWithURLTemplate_Expecter{mock: &_m.Mock}
+}
+
+// Method provides a mock function with given fields:
+func (_m *MockRequestWithURLTemplate) Method() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Method")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockRequestWithURLTemplate_Method_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Method'
+type MockRequestWithURLTemplate_Method_Call struct {
+	*mock.Call
+}
+
+// Method is a helper method to define mock.On call
+func (_e *MockRequestWithURLTemplate_Expecter) Method() *MockRequestWithURLTemplate_Method_Call {
+	return &MockRequestWithURLTemplate_Method_Call{Call: _e.mock.On("Method")}
+}
+
+func (_c *MockRequestWithURLTemplate_Method_Call) Run(run func()) *MockRequestWithURLTemplate_Method_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithURLTemplate_Method_Call) Return(_a0 string) *MockRequestWithURLTemplate_Method_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithURLTemplate_Method_Call) RunAndReturn(run func() string) *MockRequestWithURLTemplate_Method_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// URL provides a mock function with given fields:
+func (_m *MockRequestWithURLTemplate) URL() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for URL")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockRequestWithURLTemplate_URL_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'URL'
+type MockRequestWithURLTemplate_URL_Call struct {
+	*mock.Call
+}
+
+// URL is a helper method to define mock.On call
+func (_e *MockRequestWithURLTemplate_Expecter) URL() *MockRequestWithURLTemplate_URL_Call {
+	return &MockRequestWithURLTemplate_URL_Call{Call: _e.mock.On("URL")}
+}
+
+func (_c *MockRequestWithURLTemplate_URL_Call) Run(run func()) *MockRequestWithURLTemplate_URL_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithURLTemplate_URL_Call) Return(_a0 string) *MockRequestWithURLTemplate_URL_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithURLTemplate_URL_Call) RunAndReturn(run func() string) *MockRequestWithURLTemplate_URL_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// URLTemplate provides a mock function with given fields:
+func (_m *MockRequestWithURLTemplate) URLTemplate() string {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for URLTemplate")
+	}
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
+// MockRequestWithURLTemplate_URLTemplate_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'URLTemplate'
+type MockRequestWithURLTemplate_URLTemplate_Call struct {
+	*mock.Call
+}
+
+// URLTemplate is a helper method to define mock.On call
+func (_e *MockRequestWithURLTemplate_Expecter) URLTemplate() *MockRequestWithURLTemplate_URLTemplate_Call {
+	return &MockRequestWithURLTemplate_URLTemplate_Call{Call: _e.mock.On("URLTemplate")}
+}
+
+func (_c *MockRequestWithURLTemplate_URLTemplate_Call) Run(run func()) *MockRequestWithURLTemplate_URLTemplate_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockRequestWithURLTemplate_URLTemplate_Call) Return(_a0 string) *MockRequestWithURLTemplate_URLTemplate_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockRequestWithURLTemplate_URLTemplate_Call) RunAndReturn(run func() string) *MockRequestWithURLTemplate_URLTemplate_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockRequestWithURLTemplate creates a new instance of MockRequestWithURLTemplate. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockRequestWithURLTemplate(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockRequestWithURLTemplate {
+	mock := &MockRequestWithURLTemplate{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
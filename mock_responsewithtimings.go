@@ -0,0 +1,115 @@
+// Code generated by mockery. DO NOT EDIT.
+
+package httpoh
+
+import (
+	http "net/http"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// MockResponseWithTimings is an autogenerated mock type for the ResponseWithTimings type
+type MockResponseWithTimings struct {
+	mock.Mock
+}
+
+type MockResponseWithTimings_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockResponseWithTimings) EXPECT() *MockResponseWithTimings_Expecter {
+	return &MockResponseWithTimings_Expecter{mock: &_m.Mock}
+}
+
+// ProcessResponse provides a mock function with given fields: r
+func (_m *MockResponseWithTimings) ProcessResponse(r *http.Response) error {
+	ret := _m.Called(r)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ProcessResponse")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*http.Response) error); ok {
+		r0 = rf(r)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockResponseWithTimings_ProcessResponse_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ProcessResponse'
+type MockResponseWithTimings_ProcessResponse_Call struct {
+	*mock.Call
+}
+
+// ProcessResponse is a helper method to define mock.On call
+//   - r *http.Response
+func (_e *MockResponseWithTimings_Expecter) ProcessResponse(r interface{}) *MockResponseWithTimings_ProcessResponse_Call {
+	return &MockResponseWithTimings_ProcessResponse_Call{Call: _e.mock.On("ProcessResponse", r)}
+}
+
+func (_c *MockResponseWithTimings_ProcessResponse_Call) Run(run func(r *http.Response)) *MockResponseWithTimings_ProcessResponse_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(*http.Response))
+	})
+	return _c
+}
+
+func (_c *MockResponseWithTimings_ProcessResponse_Call) Return(_a0 error) *MockResponseWithTimings_ProcessResponse_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockResponseWithTimings_ProcessResponse_Call) RunAndReturn(run func(*http.Response) error) *MockResponseWithTimings_ProcessResponse_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// SetTimings provides a mock function with given fields: t
+func (_m *MockResponseWithTimings) SetTimings(t Timings) {
+	_m.Called(t)
+}
+
+// MockResponseWithTimings_SetTimings_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'SetTimings'
+type MockResponseWithTimings_SetTimings_Call struct {
+	*mock.Call
+}
+
+// SetTimings is a helper method to define mock.On call
+//   - t Timings
+func (_e *MockResponseWithTimings_Expecter) SetTimings(t interface{}) *MockResponseWithTimings_SetTimings_Call {
+	return &MockResponseWithTimings_SetTimings_Call{Call: _e.mock.On("SetTimings", t)}
+}
+
+func (_c *MockResponseWithTimings_SetTimings_Call) Run(run func(t Timings)) *MockResponseWithTimings_SetTimings_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(Timings))
+	})
+	return _c
+}
+
+func (_c *MockResponseWithTimings_SetTimings_Call) Return() *MockResponseWithTimings_SetTimings_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockResponseWithTimings_SetTimings_Call) RunAndReturn(run func(Timings)) *MockResponseWithTimings_SetTimings_Call {
+	_c.Run(run)
+	return _c
+}
+
+// NewMockResponseWithTimings creates a new instance of MockResponseWithTimings. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockResponseWithTimings(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockResponseWithTimings {
+	mock := &MockResponseWithTimings{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -2,10 +2,11 @@ package httpoh
 
 import (
 	"context"
-	"crypto/tls"
 	"io"
 	"net"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/Azure/go-ntlmssp"
 )
@@ -14,14 +15,18 @@ func NewNetHTTPClient(cfg Config) (*http.Client, error) {
 	dialer := net.Dialer{
 		Timeout: cfg.ConnectTimeout,
 	}
+	dialContext, err := newDialContext(&dialer, cfg.DNS)
+	if err != nil {
+		return nil, err
+	}
 
-	tlsConfig := &tls.Config{
-		MinVersion:         tls.VersionTLS12,
-		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	transport := &http.Transport{
-		DialContext:         dialer.DialContext,
+		DialContext:         dialContext,
 		TLSClientConfig:     tlsConfig,
 		TLSHandshakeTimeout: cfg.TLSHandshakeTimeout,
 		DisableCompression:  cfg.DisableCompression,
@@ -29,36 +34,61 @@ func NewNetHTTPClient(cfg Config) (*http.Client, error) {
 		MaxConnsPerHost:     cfg.MaxConnsPerHost,
 	}
 
+	proxy, proxyNegotiator, err := newProxy(cfg.Proxy, os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
 	var clientTransport http.RoundTripper = transport
+	if proxyNegotiator != nil {
+		proxyNegotiator.next = transport
+		proxyNegotiator.dial = dialContext
+		transport.DialContext = proxyNegotiator.dialContext
+		clientTransport = proxyNegotiator
+	}
 	if cfg.WithNTLM {
-		clientTransport = ntlmssp.Negotiator{RoundTripper: transport}
+		clientTransport = ntlmssp.Negotiator{RoundTripper: clientTransport}
 	}
 
 	c := &http.Client{
 		Transport: clientTransport,
 		Timeout:   cfg.ReadWriteTimeout,
+		Jar:       cfg.CookieJar,
 	}
 
-	if !cfg.FollowRedirect {
-		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		}
-	}
+	c.CheckRedirect = checkRedirect(cfg)
 
 	return c, nil
 }
 
+// ClientNative sends requests with an http.Client. Middlewares and
+// Authenticator are chained on the first request: set them before it, or add
+// middlewares later with Use.
 type ClientNative struct {
-	HTTP      *http.Client
-	UserAgent string
+	HTTP                 *http.Client
+	UserAgent            string
+	Middlewares          []Middleware
+	CheckStatus          bool
+	StatusErrorBodyLimit int
+	Tracer               Tracer
+	Metrics              Metrics
+	Authenticator        Authenticator
+	Streams              *StreamTracker
+
+	chain *clientChain
 }
 
 var _ Client = (*ClientNative)(nil)
 
 func NewClientNative(cfg Config, httpClient *http.Client) (*ClientNative, error) {
 	c := &ClientNative{
-		HTTP:      httpClient,
-		UserAgent: cfg.UserAgent,
+		HTTP:                 httpClient,
+		UserAgent:            cfg.UserAgent,
+		CheckStatus:          cfg.CheckStatus,
+		StatusErrorBodyLimit: cfg.StatusErrorBodyLimit,
+		Authenticator:        cfg.Authenticator,
+		chain:                &clientChain{},
 	}
 	if c.UserAgent == "" {
 		c.UserAgent = defaultUserAgent()
@@ -71,18 +101,136 @@ func defaultUserAgent() string {
 }
 
 func (c *ClientNative) PerformRequest(ctx context.Context, req Request, resp Response) error {
+	x, err := c.send(ctx, req, resp)
+	if err != nil {
+		return err
+	}
+	if !c.acceptStatus(req, resp, x.netResp.StatusCode) {
+		return x.finish(newStatusError(x.netResp, c.StatusErrorBodyLimit))
+	}
+	return x.finish(withTimeoutCause(x.ctx, resp.ProcessResponse(x.netResp)))
+}
+
+// exchange is a request sent by ClientNative along with what has to be
+// released once its response is consumed.
+type exchange struct {
+	ctx        context.Context
+	netResp    *http.Response
+	body       io.ReadCloser
+	observer   *requestObserver
+	setTimings func()
+	cancels    []func()
+}
+
+// finish closes the response body and releases the exchange, returning err.
+func (x *exchange) finish(err error) error {
+	if x.body != nil {
+		x.body.Close()
+	}
+	x.release(err)
+	return err
+}
+
+// release reports the outcome of the exchange and cancels its context.
+func (x *exchange) release(err error) {
+	if x.setTimings != nil {
+		x.setTimings()
+	}
+	x.observer.end(err)
+	for i := len(x.cancels) - 1; i >= 0; i-- {
+		x.cancels[i]()
+	}
+}
+
+// send performs req up to receiving the response headers. On error the
+// exchange is already released. resp may be nil.
+func (c *ClientNative) send(ctx context.Context, req Request, resp Response) (*exchange, error) {
+	x := &exchange{}
+	opts := requestOptions(req)
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		x.cancels = append(x.cancels, cancel)
+	}
+	cancelCause := context.CancelCauseFunc(func(error) {})
+	if opts.ResponseHeaderTimeout > 0 || opts.IdleReadTimeout > 0 {
+		ctx, cancelCause = context.WithCancelCause(ctx)
+		x.cancels = append(x.cancels, func() { cancelCause(nil) })
+	}
+	if opts.FollowRedirect != nil {
+		ctx = withFollowRedirect(ctx, *opts.FollowRedirect)
+	}
+	if opts.RedirectPolicy != nil {
+		ctx = withRedirectPolicy(ctx, opts.RedirectPolicy)
+	}
+
+	ctx, x.observer = c.observe(ctx, req)
+
+	if tResp, implements := findResponse[ResponseWithTimings](resp); implements {
+		var recorder *timingsRecorder
+		ctx, recorder = withTimingsTrace(ctx)
+		x.setTimings = func() { tResp.SetTimings(recorder.result()) }
+	}
+	x.ctx = ctx
+
+	netReq, err := c.newRequest(ctx, req, opts)
+	if err != nil {
+		return nil, x.finish(err)
+	}
+	x.observer.request(ctx, netReq)
+
+	var headerTimer *time.Timer
+	if opts.ResponseHeaderTimeout > 0 {
+		headerTimer = time.AfterFunc(opts.ResponseHeaderTimeout, func() { cancelCause(ErrResponseHeaderTimeout) })
+	}
+	netResp, err := c.roundTripper().RoundTrip(netReq)
+	if headerTimer != nil {
+		headerTimer.Stop()
+	}
+	if err != nil {
+		return nil, x.finish(withTimeoutCause(ctx, err))
+	}
+	if opts.IdleReadTimeout > 0 {
+		netResp.Body = newIdleTimeoutReader(netResp.Body, opts.IdleReadTimeout, func() { cancelCause(ErrIdleReadTimeout) })
+	}
+	x.observer.response(netResp)
+	x.netResp, x.body = netResp, netResp.Body
+	return x, nil
+}
+
+func (c *ClientNative) newRequest(ctx context.Context, req Request, opts RequestOptions) (*http.Request, error) {
 	httpRequestMethod, httpRequestURL := req.Method(), req.URL()
 	var httpRequestBody io.Reader
-	if bReq, implements := req.(RequestWithBody); implements {
+	rReq, replayable := req.(RequestWithReplayableBody)
+	if replayable {
+		body, err := rReq.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		httpRequestBody = body
+	} else if bReq, implements := req.(RequestWithBody); implements {
 		httpRequestBody = bReq.Body()
 	}
 
 	netReq, err := http.NewRequestWithContext(ctx, httpRequestMethod, httpRequestURL, httpRequestBody)
 	if err != nil {
-		return err
+		if closer, ok := httpRequestBody.(io.Closer); ok && replayable {
+			closer.Close()
+		}
+		return nil, err
+	}
+	if replayable {
+		netReq.GetBody = rReq.GetBody
+		if length := rReq.ContentLength(); length >= 0 {
+			netReq.ContentLength = length
+		}
 	}
 
-	netReq.Header.Set("User-Agent", c.UserAgent)
+	userAgent := c.UserAgent
+	if opts.UserAgent != "" {
+		userAgent = opts.UserAgent
+	}
+	netReq.Header.Set("User-Agent", userAgent)
 	if hReq, implements := req.(RequestWithHeaders); implements {
 		for name, vals := range hReq.Headers() {
 			for i, value := range vals {
@@ -95,13 +243,5 @@ func (c *ClientNative) PerformRequest(ctx context.Context, req Request, resp Res
 		}
 	}
 
-	netResp, err := c.HTTP.Do(netReq)
-	if err != nil {
-		return err
-	}
-	defer netResp.Body.Close()
-
-	err = resp.ProcessResponse(netResp)
-
-	return err
+	return netReq, nil
 }
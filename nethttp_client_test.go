@@ -322,3 +322,82 @@ func TestRequestWithBody(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestWithReplayableBody(t *testing.T) {
+	for _, tc := range []struct {
+		Name              string
+		RequestBody       string
+		ContentLength     int64
+		WantContentLength int64
+		WantBodyCalls     int
+	}{
+		{
+			Name:              "known length resent on redirect",
+			RequestBody:       "BODY",
+			ContentLength:     4,
+			WantContentLength: 4,
+			WantBodyCalls:     2,
+		},
+		{
+			Name:              "unknown length resent on redirect",
+			RequestBody:       "BODY",
+			ContentLength:     -1,
+			WantContentLength: -1,
+			WantBodyCalls:     2,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.Handle("/redirect", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				http.Redirect(w, r, "/target", http.StatusTemporaryRedirect)
+			}))
+			mux.Handle("/target", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, tc.WantContentLength, r.ContentLength)
+				body := bytes.NewBuffer(nil)
+				io.Copy(body, r.Body)
+				assert.Equal(t, tc.RequestBody, body.String())
+				w.WriteHeader(http.StatusOK)
+			}))
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			bodyCalls := 0
+			req := NewMockRequestWithReplayableBody(t)
+			req.EXPECT().URL().Return(server.URL + "/redirect")
+			req.EXPECT().Method().Return(http.MethodPost)
+			req.EXPECT().ContentLength().Return(tc.ContentLength)
+			req.EXPECT().GetBody().RunAndReturn(func() (io.ReadCloser, error) {
+				bodyCalls++
+				return io.NopCloser(strings.NewReader(tc.RequestBody)), nil
+			})
+
+			client, newError := NewClientNative(Config{}, server.Client())
+			require.NoError(t, newError)
+
+			resp := NewMockResponse(t)
+			resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+				assert.Equal(t, http.StatusOK, r.StatusCode)
+				return nil
+			})
+
+			gotError := client.PerformRequest(context.Background(), req, resp)
+			assert.NoError(t, gotError)
+			assert.Equal(t, tc.WantBodyCalls, bodyCalls)
+		})
+	}
+}
+
+func TestRequestWithReplayableBodyError(t *testing.T) {
+	req := NewMockRequestWithReplayableBody(t)
+	req.EXPECT().URL().Return("http://127.0.0.1:1")
+	req.EXPECT().Method().Return(http.MethodPost)
+	req.EXPECT().GetBody().Return(nil, errors.New("WTF"))
+
+	client, newError := NewClientNative(Config{}, http.DefaultClient)
+	require.NoError(t, newError)
+
+	gotError := client.PerformRequest(context.Background(), req, NewMockResponse(t))
+	assert.ErrorContains(t, gotError, "WTF")
+}
@@ -0,0 +1,336 @@
+package httpoh
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OAuth2Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Expiry       time.Time
+}
+
+// OAuth2Error is returned when the token endpoint answers with an error.
+type OAuth2Error struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *OAuth2Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("oauth2 token: unexpected response status %d", e.StatusCode)
+	}
+	if e.Description == "" {
+		return fmt.Sprintf("oauth2 token: %s", e.Code)
+	}
+	return fmt.Sprintf("oauth2 token: %s: %s", e.Code, e.Description)
+}
+
+type OAuth2Config struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// RefreshToken switches the source to the refresh token grant. Without it
+	// tokens are requested with the client credentials grant, and a refresh
+	// token issued along with them is used when available.
+	RefreshToken string
+	// ClientAuthInBody sends client_id and client_secret as form parameters
+	// instead of HTTP Basic authentication.
+	ClientAuthInBody bool
+	// ExpirySkew is how long before the expiry a token is refreshed, 10s by default.
+	ExpirySkew time.Duration
+	// FetchTimeout limits a token endpoint call, 30s by default. The call is
+	// shared by concurrent requests and does not end when one of them does.
+	FetchTimeout time.Duration
+	Now          func() time.Time
+}
+
+// OAuth2TokenSource gets OAuth2 access tokens from the token endpoint with
+// Client and caches them until ExpirySkew before they expire. Concurrent
+// requests for an expired token share a single token endpoint call.
+//
+// OAuth2TokenSource is an Authenticator: set it as Config.Authenticator, or
+// ClientNative.Authenticator, to send the token with every request, including
+// the ClientNative it gets tokens with. A 401 response drops the cached token,
+// and the request is sent once more with a new token when its body can be
+// replayed.
+type OAuth2TokenSource struct {
+	Client           Client
+	TokenURL         string
+	ClientID         string
+	ClientSecret     string
+	Scopes           []string
+	ClientAuthInBody bool
+	ExpirySkew       time.Duration
+	FetchTimeout     time.Duration
+	Now              func() time.Time
+
+	mu           sync.Mutex
+	token        *OAuth2Token
+	refreshToken string
+	refreshOnly  bool
+	fetching     *tokenFetch
+}
+
+var _ Authenticator = (*OAuth2TokenSource)(nil)
+
+// oauth2TokenRequestKey marks the context of token requests with their
+// source, so they pass through its Wrap when the source authenticates the
+// client it sends them with.
+type oauth2TokenRequestKey struct{}
+
+type tokenFetch struct {
+	done  chan struct{}
+	token *OAuth2Token
+	err   error
+}
+
+func NewOAuth2TokenSource(cfg OAuth2Config, client Client) (*OAuth2TokenSource, error) {
+	if client == nil {
+		return nil, errors.New("oauth2 token source: client is nil")
+	}
+	if _, err := url.Parse(cfg.TokenURL); err != nil || cfg.TokenURL == "" {
+		return nil, fmt.Errorf("oauth2 token source: invalid token url %q", cfg.TokenURL)
+	}
+
+	s := &OAuth2TokenSource{
+		Client:           client,
+		TokenURL:         cfg.TokenURL,
+		ClientID:         cfg.ClientID,
+		ClientSecret:     cfg.ClientSecret,
+		Scopes:           cfg.Scopes,
+		ClientAuthInBody: cfg.ClientAuthInBody,
+		ExpirySkew:       cfg.ExpirySkew,
+		FetchTimeout:     cfg.FetchTimeout,
+		Now:              cfg.Now,
+		refreshToken:     cfg.RefreshToken,
+		refreshOnly:      cfg.RefreshToken != "",
+	}
+	if s.ExpirySkew == 0 {
+		s.ExpirySkew = 10 * time.Second
+	}
+	if s.FetchTimeout == 0 {
+		s.FetchTimeout = 30 * time.Second
+	}
+	if s.Now == nil {
+		s.Now = time.Now
+	}
+	return s, nil
+}
+
+// Token returns a cached token, or gets a new one when the cached token
+// expires in less than ExpirySkew.
+func (s *OAuth2TokenSource) Token(ctx context.Context) (OAuth2Token, error) {
+	s.mu.Lock()
+	if s.token != nil && (s.token.Expiry.IsZero() || s.Now().Add(s.ExpirySkew).Before(s.token.Expiry)) {
+		token := *s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	fetch := s.fetching
+	if fetch == nil {
+		fetch = &tokenFetch{done: make(chan struct{})}
+		s.fetching = fetch
+		// the call is shared: one caller giving up must not fail the others
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.FetchTimeout)
+		go func() {
+			defer cancel()
+			s.fetch(fetchCtx, fetch)
+		}()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		if fetch.err != nil {
+			return OAuth2Token{}, fetch.err
+		}
+		return *fetch.token, nil
+	case <-ctx.Done():
+		return OAuth2Token{}, ctx.Err()
+	}
+}
+
+// Invalidate drops the cached token if it is still accessToken, so the next
+// Token call gets a new one.
+func (s *OAuth2TokenSource) Invalidate(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && s.token.AccessToken == accessToken {
+		s.token = nil
+	}
+}
+
+func (s *OAuth2TokenSource) fetch(ctx context.Context, fetch *tokenFetch) {
+	s.mu.Lock()
+	refreshToken := s.refreshToken
+	s.mu.Unlock()
+
+	token, err := s.requestToken(ctx, refreshToken)
+	var oauthErr *OAuth2Error
+	fallback := refreshToken != "" && !s.refreshOnly && errors.As(err, &oauthErr)
+	if fallback {
+		token, err = s.requestToken(ctx, "")
+	}
+
+	s.mu.Lock()
+	if fallback {
+		s.refreshToken = ""
+	}
+	if err == nil {
+		s.token = token
+		if token.RefreshToken != "" {
+			s.refreshToken = token.RefreshToken
+		}
+	}
+	s.fetching = nil
+	s.mu.Unlock()
+
+	fetch.token, fetch.err = token, err
+	close(fetch.done)
+}
+
+func (s *OAuth2TokenSource) requestToken(ctx context.Context, refreshToken string) (*OAuth2Token, error) {
+	form := url.Values{}
+	if refreshToken != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", refreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(s.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.Scopes, " "))
+	}
+	req := &oauth2TokenRequest{url: s.TokenURL, header: http.Header{}}
+	req.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.header.Set("Accept", "application/json")
+	if s.ClientAuthInBody {
+		form.Set("client_id", s.ClientID)
+		form.Set("client_secret", s.ClientSecret)
+	} else if s.ClientID != "" {
+		credentials := url.QueryEscape(s.ClientID) + ":" + url.QueryEscape(s.ClientSecret)
+		req.header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	req.body = form.Encode()
+
+	ctx = context.WithValue(ctx, oauth2TokenRequestKey{}, s)
+	started := s.Now()
+	resp := &oauth2TokenResponse{}
+	if err := s.Client.PerformRequest(ctx, req, resp); err != nil {
+		return nil, fmt.Errorf("oauth2 token: %w", err)
+	}
+	if !isSuccessStatus(resp.statusCode) {
+		return nil, &OAuth2Error{StatusCode: resp.statusCode, Code: resp.body.Error, Description: resp.body.ErrorDescription}
+	}
+	if resp.decodeErr != nil {
+		return nil, fmt.Errorf("oauth2 token: decode response: %w", resp.decodeErr)
+	}
+	if resp.body.AccessToken == "" {
+		return nil, errors.New("oauth2 token: empty access_token in response")
+	}
+	if resp.body.TokenType != "" && !strings.EqualFold(resp.body.TokenType, "bearer") {
+		return nil, fmt.Errorf("oauth2 token: unsupported token type %q", resp.body.TokenType)
+	}
+
+	token := &OAuth2Token{
+		AccessToken:  resp.body.AccessToken,
+		TokenType:    resp.body.TokenType,
+		RefreshToken: resp.body.RefreshToken,
+	}
+	if expiresIn, _ := resp.body.ExpiresIn.Int64(); expiresIn > 0 {
+		token.Expiry = started.Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+func (s *OAuth2TokenSource) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Header.Get("Authorization") != "" || r.Context().Value(oauth2TokenRequestKey{}) == s {
+			return next.RoundTrip(r)
+		}
+
+		token, err := s.Token(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		resp, err := next.RoundTrip(r)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+
+		s.Invalidate(token.AccessToken)
+		if token, err = s.Token(r.Context()); err != nil {
+			return resp, nil
+		}
+		retry, ok := rewindRequest(r)
+		if !ok {
+			return resp, nil
+		}
+		discardBody(resp)
+		retry.Header.Set("Authorization", "Bearer "+token.AccessToken)
+		return next.RoundTrip(retry)
+	})
+}
+
+type oauth2TokenRequest struct {
+	url    string
+	header http.Header
+	body   string
+}
+
+func (r *oauth2TokenRequest) Method() string       { return http.MethodPost }
+func (r *oauth2TokenRequest) URL() string          { return r.url }
+func (r *oauth2TokenRequest) Headers() http.Header { return r.header }
+func (r *oauth2TokenRequest) Body() io.Reader      { return strings.NewReader(r.body) }
+func (r *oauth2TokenRequest) ContentLength() int64 { return int64(len(r.body)) }
+func (r *oauth2TokenRequest) GetBody() (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(r.body)), nil
+}
+
+// Options lets RetryClient repeat token requests: a lost response only leaves
+// a token unused.
+func (r *oauth2TokenRequest) Options() RequestOptions {
+	return RequestOptions{Idempotent: true}
+}
+
+type oauth2TokenResponse struct {
+	statusCode int
+	decodeErr  error
+	body       struct {
+		AccessToken      string      `json:"access_token"`
+		TokenType        string      `json:"token_type"`
+		RefreshToken     string      `json:"refresh_token"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+}
+
+// AcceptStatus lets error responses through to read the OAuth2 error code.
+func (r *oauth2TokenResponse) AcceptStatus(int) bool { return true }
+
+func (r *oauth2TokenResponse) ProcessResponse(netResp *http.Response) error {
+	r.statusCode = netResp.StatusCode
+	r.decodeErr = json.NewDecoder(io.LimitReader(netResp.Body, 1<<20)).Decode(&r.body)
+	if r.decodeErr == nil && r.body.ExpiresIn != "" {
+		if _, err := strconv.ParseInt(string(r.body.ExpiresIn), 10, 64); err != nil {
+			r.decodeErr = fmt.Errorf("invalid expires_in %q", r.body.ExpiresIn)
+		}
+	}
+	return nil
+}
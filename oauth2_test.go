@@ -0,0 +1,304 @@
+package httpoh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tokenTestServer struct {
+	*httptest.Server
+	mu            sync.Mutex
+	issued        int
+	valid         map[string]bool
+	refreshTokens map[string]bool
+	grants        []string
+	requests      []string
+	tokenStatus   []int
+	tokenDelay    time.Duration
+}
+
+func newTokenTestServer(t *testing.T) *tokenTestServer {
+	s := &tokenTestServer{valid: make(map[string]bool), refreshTokens: make(map[string]bool)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			time.Sleep(s.tokenDelay)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/token" {
+			token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			s.requests = append(s.requests, token)
+			if !s.valid[token] {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			io.Copy(w, r.Body)
+			return
+		}
+
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok {
+			clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+		}
+		assert.Equal(t, "client", clientID)
+		assert.Equal(t, "secret", clientSecret)
+		grant := r.PostFormValue("grant_type")
+		s.grants = append(s.grants, grant)
+		if len(s.tokenStatus) > 0 {
+			status := s.tokenStatus[0]
+			s.tokenStatus = s.tokenStatus[1:]
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"WTF"}`))
+			return
+		}
+		if grant == "refresh_token" && !s.refreshTokens[r.PostFormValue("refresh_token")] {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		delete(s.refreshTokens, r.PostFormValue("refresh_token"))
+
+		s.issued++
+		token, refreshToken := fmt.Sprintf("token-%d", s.issued), fmt.Sprintf("refresh-%d", s.issued)
+		s.valid[token] = true
+		s.refreshTokens[refreshToken] = true
+		fmt.Fprintf(w, `{"access_token":%q,"token_type":"bearer","expires_in":"3600","refresh_token":%q}`, token, refreshToken)
+	}))
+	return s
+}
+
+func (s *tokenTestServer) revokeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.valid)
+	s.requests = nil
+}
+
+func newTestTokenSource(t *testing.T, server *tokenTestServer, cfg OAuth2Config) *OAuth2TokenSource {
+	tokenClient, newError := NewClientNative(Config{}, &http.Client{})
+	require.NoError(t, newError)
+	cfg.TokenURL = server.URL + "/token"
+	cfg.ClientID, cfg.ClientSecret = "client", "secret"
+	source, newError := NewOAuth2TokenSource(cfg, tokenClient)
+	require.NoError(t, newError)
+	return source
+}
+
+func TestOAuth2TokenSourceAuthenticator(t *testing.T) {
+	server := newTokenTestServer(t)
+	defer server.Close()
+	clock := newFakeClock()
+	source := newTestTokenSource(t, server, OAuth2Config{Scopes: []string{"read", "write"}, Now: clock.Now})
+
+	client, newError := NewClientNative(Config{Authenticator: source, CheckStatus: true}, &http.Client{})
+	require.NoError(t, newError)
+	get := func() {
+		require.NoError(t, client.PerformRequest(context.Background(), testGet(server.URL), &testResponse{}))
+	}
+
+	get()
+	get()
+	assert.Equal(t, []string{"token-1", "token-1"}, server.requests)
+
+	// refreshed ExpirySkew before expiration with the refresh token
+	clock.Advance(time.Hour - 5*time.Second)
+	get()
+	assert.Equal(t, "token-2", server.requests[2])
+	assert.Equal(t, []string{"client_credentials", "refresh_token"}, server.grants)
+
+	// refresh on 401, replayable body is sent again
+	server.revokeAll()
+	req, newError := NewJSONRequest(http.MethodPost, server.URL, map[string]int{"n": 1})
+	require.NoError(t, newError)
+	resp := &JSONResponse[map[string]int]{}
+	require.NoError(t, client.PerformRequest(context.Background(), req, resp))
+	assert.Equal(t, map[string]int{"n": 1}, resp.Data)
+	assert.Equal(t, []string{"token-2", "token-3"}, server.requests)
+
+	// the 401 comes back when the body can not be sent again
+	server.revokeAll()
+	bReq := NewMockRequestWithBody(t)
+	bReq.EXPECT().URL().Return(server.URL)
+	bReq.EXPECT().Method().Return(http.MethodPost)
+	bReq.EXPECT().Body().Return(io.MultiReader(strings.NewReader("body")))
+	var statusErr *StatusError
+	require.ErrorAs(t, client.PerformRequest(context.Background(), bReq, &testResponse{}), &statusErr)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+	assert.Equal(t, []string{"token-3"}, server.requests)
+}
+
+func TestOAuth2TokenSourceGrants(t *testing.T) {
+	for _, tc := range []struct {
+		Name         string
+		Config       OAuth2Config
+		TokenStatus  []int
+		WantGrants   []string
+		WantToken    string
+		WantOAuthErr string
+	}{
+		{
+			Name:       "client credentials in body",
+			Config:     OAuth2Config{ClientAuthInBody: true},
+			WantGrants: []string{"client_credentials"},
+			WantToken:  "token-1",
+		},
+		{
+			Name:         "refresh token only",
+			Config:       OAuth2Config{RefreshToken: "unknown"},
+			WantGrants:   []string{"refresh_token"},
+			WantOAuthErr: "invalid_grant",
+		},
+		{
+			Name:         "token endpoint error",
+			TokenStatus:  []int{http.StatusUnauthorized},
+			WantGrants:   []string{"client_credentials"},
+			WantOAuthErr: "invalid_client",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := newTokenTestServer(t)
+			defer server.Close()
+			server.tokenStatus = tc.TokenStatus
+			source := newTestTokenSource(t, server, tc.Config)
+
+			token, err := source.Token(context.Background())
+			assert.Equal(t, tc.WantGrants, server.grants)
+			if tc.WantOAuthErr != "" {
+				var oauthErr *OAuth2Error
+				require.ErrorAs(t, err, &oauthErr)
+				assert.Equal(t, tc.WantOAuthErr, oauthErr.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.WantToken, token.AccessToken)
+			assert.Equal(t, "refresh-1", token.RefreshToken)
+		})
+	}
+}
+
+func TestOAuth2TokenSourceRefreshFallback(t *testing.T) {
+	server := newTokenTestServer(t)
+	defer server.Close()
+	clock := newFakeClock()
+	source := newTestTokenSource(t, server, OAuth2Config{Now: clock.Now})
+
+	_, err := source.Token(context.Background())
+	require.NoError(t, err)
+	clear(server.refreshTokens)
+	clock.Advance(time.Hour)
+
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+	assert.Equal(t, []string{"client_credentials", "refresh_token", "client_credentials"}, server.grants)
+}
+
+func TestOAuth2TokenSourceSingleflight(t *testing.T) {
+	server := newTokenTestServer(t)
+	defer server.Close()
+	server.tokenDelay = 50 * time.Millisecond
+	source := newTestTokenSource(t, server, OAuth2Config{})
+
+	// a caller giving up does not fail the shared call
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := source.Token(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token(context.Background())
+			assert.NoError(t, err)
+			tokens[i] = token.AccessToken
+		}()
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		assert.Equal(t, "token-1", token)
+	}
+	assert.Equal(t, 1, server.issued)
+}
+
+func TestOAuth2TokenSourceFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	tokenClient, newError := NewClientNative(Config{}, &http.Client{})
+	require.NoError(t, newError)
+	source, newError := NewOAuth2TokenSource(OAuth2Config{TokenURL: hanging.URL, FetchTimeout: 50 * time.Millisecond}, tokenClient)
+	require.NoError(t, newError)
+
+	// the shared call ends even when no caller has a deadline
+	_, err := source.Token(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	source.mu.Lock()
+	assert.Nil(t, source.fetching)
+	source.mu.Unlock()
+}
+
+func TestOAuth2TokenSourceUsesClient(t *testing.T) {
+	server := newTokenTestServer(t)
+	defer server.Close()
+	server.tokenStatus = []int{http.StatusServiceUnavailable}
+
+	native, newError := NewClientNative(Config{}, &http.Client{})
+	require.NoError(t, newError)
+	retry, newError := NewRetryClient(RetryConfig{Backoff: ExponentialBackoff{Base: time.Millisecond}}, native)
+	require.NoError(t, newError)
+	source, newError := NewOAuth2TokenSource(OAuth2Config{TokenURL: server.URL + "/token", ClientID: "client", ClientSecret: "secret"}, retry)
+	require.NoError(t, newError)
+
+	token, err := source.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+	assert.Equal(t, []string{"client_credentials", "client_credentials"}, server.grants)
+
+	_, newError = NewOAuth2TokenSource(OAuth2Config{}, retry)
+	assert.Error(t, newError)
+	_, newError = NewOAuth2TokenSource(OAuth2Config{TokenURL: server.URL}, nil)
+	assert.Error(t, newError)
+}
+
+func TestOAuth2TokenSourceSharedClient(t *testing.T) {
+	server := newTokenTestServer(t)
+	defer server.Close()
+	for _, cfg := range []OAuth2Config{
+		{ClientID: "client", ClientSecret: "secret", ClientAuthInBody: true},
+		{ClientID: "client", ClientSecret: "secret"},
+	} {
+		client, newError := NewClientNative(Config{CheckStatus: true}, &http.Client{})
+		require.NoError(t, newError)
+		cfg.TokenURL = server.URL + "/token"
+		source, newError := NewOAuth2TokenSource(cfg, client)
+		require.NoError(t, newError)
+		client.Authenticator = source
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		require.NoError(t, client.PerformRequest(ctx, testGet(server.URL), &testResponse{}))
+		cancel()
+	}
+	assert.Equal(t, []string{"token-1", "token-2"}, server.requests)
+}
@@ -0,0 +1,88 @@
+package httpoh
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// requestObserver reports a single PerformRequest call to the client Tracer
+// and Metrics. All methods are safe to call on nil.
+type requestObserver struct {
+	trace   *requestTrace
+	metrics Metrics
+	measure RequestMetrics
+	started time.Time
+	body    *countingReader
+}
+
+func (c *ClientNative) observe(ctx context.Context, req Request) (context.Context, *requestObserver) {
+	if c.Tracer == nil && c.Metrics == nil {
+		return ctx, nil
+	}
+
+	o := &requestObserver{metrics: c.Metrics, started: time.Now()}
+	if c.Tracer != nil {
+		ctx, o.trace = startRequestTrace(ctx, c.Tracer, req)
+	}
+	if c.Metrics != nil {
+		o.measure.Method = req.Method()
+		if u, err := url.Parse(req.URL()); err == nil {
+			o.measure.Host = u.Host
+		}
+		c.Metrics.RequestStarted(o.measure.Method, o.measure.Host)
+	}
+	return ctx, o
+}
+
+func (o *requestObserver) request(ctx context.Context, netReq *http.Request) {
+	if o == nil || o.trace == nil {
+		return
+	}
+	o.trace.inject(ctx, netReq)
+}
+
+func (o *requestObserver) response(netResp *http.Response) {
+	if o == nil {
+		return
+	}
+	o.measure.StatusCode = netResp.StatusCode
+	o.body = &countingReader{ReadCloser: netResp.Body}
+	netResp.Body = o.body
+	if o.trace != nil {
+		o.trace.response(netResp)
+	}
+}
+
+func (o *requestObserver) end(err error) {
+	if o == nil {
+		return
+	}
+	bodySize := int64(-1)
+	if o.body != nil {
+		bodySize = o.body.n
+	}
+	if o.trace != nil {
+		o.trace.end(bodySize, err)
+	}
+	if o.metrics != nil {
+		o.measure.Duration = time.Since(o.started)
+		o.measure.ResponseSize = max(bodySize, 0)
+		o.measure.Err = err
+		o.metrics.RequestFinished(o.measure)
+	}
+}
+
+// countingReader counts bytes read from the response body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
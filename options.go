@@ -0,0 +1,75 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	ErrResponseHeaderTimeout = errors.New("response header timeout")
+	ErrIdleReadTimeout       = errors.New("idle read timeout")
+)
+
+func requestOptions(req Request) RequestOptions {
+	if oReq, implements := req.(RequestWithOptions); implements {
+		return oReq.Options()
+	}
+	return RequestOptions{}
+}
+
+// withTimeoutCause adds the reason of a per-request timeout to err.
+func withTimeoutCause(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrResponseHeaderTimeout) || errors.Is(cause, ErrIdleReadTimeout) {
+		if !errors.Is(err, cause) {
+			return fmt.Errorf("%w: %w", cause, err)
+		}
+	}
+	return err
+}
+
+// idleTimeoutReader calls expire when a Read blocks for longer than timeout.
+// Time spent by the caller between reads does not count.
+type idleTimeoutReader struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration, expire func()) *idleTimeoutReader {
+	timer := time.AfterFunc(timeout, expire)
+	timer.Stop()
+	return &idleTimeoutReader{
+		ReadCloser: body,
+		timeout:    timeout,
+		timer:      timer,
+	}
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	r.timer.Reset(r.timeout)
+	defer r.timer.Stop()
+	return r.ReadCloser.Read(p)
+}
+
+func (r *idleTimeoutReader) Close() error {
+	r.timer.Stop()
+	return r.ReadCloser.Close()
+}
+
+type followRedirectKey struct{}
+
+func withFollowRedirect(ctx context.Context, follow bool) context.Context {
+	return context.WithValue(ctx, followRedirectKey{}, follow)
+}
+
+func followRedirectFromContext(ctx context.Context) (follow bool, ok bool) {
+	follow, ok = ctx.Value(followRedirectKey{}).(bool)
+	return follow, ok
+}
@@ -0,0 +1,222 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestOptions(t *testing.T) {
+	follow, noFollow := true, false
+	release := make(chan struct{})
+	for _, tc := range []struct {
+		Name          string
+		Config        Config
+		Options       RequestOptions
+		ServerHandler http.HandlerFunc
+		// ReadPause is waited before reading the response body, then
+		// Release is closed: timers that should be stopped by then would
+		// fire during the pause.
+		ReadPause   time.Duration
+		Release     chan struct{}
+		WantStatus  int
+		WantBody    string
+		WantErrorIs error
+	}{
+		{
+			Name:    "user agent override",
+			Config:  Config{UserAgent: "config UA"},
+			Options: RequestOptions{UserAgent: "request UA"},
+			ServerHandler: func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "request UA", r.Header.Get("User-Agent"))
+				w.Write([]byte("OK"))
+			},
+			WantStatus: http.StatusOK,
+			WantBody:   "OK",
+		},
+		{
+			Name:    "total timeout",
+			Options: RequestOptions{Timeout: 20 * time.Millisecond},
+			ServerHandler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			},
+			WantErrorIs: context.DeadlineExceeded,
+		},
+		{
+			Name:    "response header timeout",
+			Options: RequestOptions{ResponseHeaderTimeout: 20 * time.Millisecond},
+			ServerHandler: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			},
+			WantErrorIs: ErrResponseHeaderTimeout,
+		},
+		{
+			Name:    "response header timer stops with headers",
+			Options: RequestOptions{ResponseHeaderTimeout: 20 * time.Millisecond},
+			ServerHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+				select {
+				case <-release:
+					w.Write([]byte("late body"))
+				case <-r.Context().Done():
+				}
+			},
+			ReadPause:  40 * time.Millisecond,
+			Release:    release,
+			WantStatus: http.StatusOK,
+			WantBody:   "late body",
+		},
+		{
+			Name:    "idle read timeout",
+			Options: RequestOptions{IdleReadTimeout: 20 * time.Millisecond},
+			ServerHandler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("first"))
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			},
+			WantStatus:  http.StatusOK,
+			WantErrorIs: ErrIdleReadTimeout,
+		},
+		{
+			Name:    "idle read timer stopped before the first read",
+			Options: RequestOptions{IdleReadTimeout: 20 * time.Millisecond},
+			ServerHandler: func(w http.ResponseWriter, r *http.Request) {
+				for _, chunk := range []string{"a", "b", "c", "d"} {
+					w.Write([]byte(chunk))
+					w.(http.Flusher).Flush()
+				}
+			},
+			ReadPause:  40 * time.Millisecond,
+			WantStatus: http.StatusOK,
+			WantBody:   "abcd",
+		},
+		{
+			Name:    "follow redirect override",
+			Config:  Config{FollowRedirect: false},
+			Options: RequestOptions{FollowRedirect: &follow},
+			ServerHandler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" {
+					http.Redirect(w, r, "/target", http.StatusFound)
+					return
+				}
+				w.Write([]byte("target"))
+			},
+			WantStatus: http.StatusOK,
+			WantBody:   "target",
+		},
+		{
+			Name:    "no follow redirect override",
+			Config:  Config{FollowRedirect: true},
+			Options: RequestOptions{FollowRedirect: &noFollow},
+			ServerHandler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/" {
+					http.Redirect(w, r, "/target", http.StatusFound)
+					return
+				}
+				w.Write([]byte("target"))
+			},
+			WantStatus: http.StatusFound,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := httptest.NewServer(tc.ServerHandler)
+			defer server.Close()
+
+			httpClient, newError := NewNetHTTPClient(tc.Config)
+			require.NoError(t, newError)
+			client, newError := NewClientNative(tc.Config, httpClient)
+			require.NoError(t, newError)
+
+			req := NewMockRequestWithOptions(t)
+			req.EXPECT().URL().Return(server.URL)
+			req.EXPECT().Method().Return(http.MethodGet)
+			req.EXPECT().Options().Return(tc.Options)
+
+			resp := NewMockResponse(t)
+			if tc.WantStatus != 0 {
+				resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+					assert.Equal(t, tc.WantStatus, r.StatusCode)
+					time.Sleep(tc.ReadPause)
+					if tc.Release != nil {
+						close(tc.Release)
+					}
+					body, err := io.ReadAll(r.Body)
+					if err != nil {
+						return err
+					}
+					if tc.WantBody != "" {
+						assert.Equal(t, tc.WantBody, string(body))
+					}
+					return nil
+				})
+			}
+
+			gotError := client.PerformRequest(context.Background(), req, resp)
+			if tc.WantErrorIs == nil {
+				assert.NoError(t, gotError)
+			} else {
+				assert.True(t, errors.Is(gotError, tc.WantErrorIs), "got error %v", gotError)
+			}
+		})
+	}
+}
+
+func TestIdleReadTimeoutIgnoresCallerPauses(t *testing.T) {
+	next := make(chan struct{}, 20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 20; i++ {
+			w.Write([]byte("x"))
+			w.(http.Flusher).Flush()
+			select {
+			case <-next:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	client, err := NewClientNative(Config{}, &http.Client{})
+	require.NoError(t, err)
+
+	req := NewMockRequestWithOptions(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodGet)
+	req.EXPECT().Options().Return(RequestOptions{IdleReadTimeout: 20 * time.Millisecond})
+	stream, err := client.Stream(context.Background(), req)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	// bytes are sent one at a time once the previous one is read, the
+	// caller pauses longer than the timeout after the first one
+	var body []byte
+	buf := make([]byte, 1)
+	for i := 0; i < 20; i++ {
+		_, err = io.ReadFull(stream, buf)
+		require.NoError(t, err)
+		body = append(body, buf...)
+		if i == 0 {
+			time.Sleep(40 * time.Millisecond)
+		}
+		next <- struct{}{}
+	}
+	assert.Len(t, body, 20)
+}
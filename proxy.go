@@ -0,0 +1,401 @@
+package httpoh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// ProxyConfig selects the proxy of the client built by NewNetHTTPClient.
+//
+// URL is an explicit http://, https:// or socks5:// proxy, with optional
+// user:password credentials. FromEnvironment takes proxies from HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY (or their lowercase forms) when the client is built;
+// as with net/http, requests to localhost are never sent to those proxies.
+// NoProxy lists destinations reached directly, in NO_PROXY format: "*", IP
+// addresses, CIDR ranges and host names matching the host and its
+// subdomains, each with an optional ":port".
+//
+// NTLM uses the credentials of an http:// URL for NTLM authentication to the
+// proxy instead of Basic, for plain HTTP requests and for the CONNECT tunnels
+// of HTTPS ones. Config.WithNTLM is independent: it authenticates to the
+// destination server.
+type ProxyConfig struct {
+	URL             string
+	FromEnvironment bool
+	NoProxy         []string
+	NTLM            bool
+}
+
+type proxyFunc func(*http.Request) (*url.URL, error)
+
+func newProxy(c ProxyConfig, getenv func(string) string) (proxyFunc, *proxyNTLMNegotiator, error) {
+	if c.URL != "" && c.FromEnvironment {
+		return nil, nil, errors.New("proxy config: URL and FromEnvironment are mutually exclusive")
+	}
+	noProxy := parseNoProxy(c.NoProxy)
+
+	if c.URL != "" {
+		proxyURL, err := parseProxyURL(c.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+		var negotiator *proxyNTLMNegotiator
+		if c.NTLM {
+			if proxyURL.Scheme != "http" || proxyURL.User == nil {
+				return nil, nil, errors.New("proxy config: NTLM needs an http:// proxy URL with credentials")
+			}
+			password, _ := proxyURL.User.Password()
+			negotiator = &proxyNTLMNegotiator{
+				username: proxyURL.User.Username(),
+				password: password,
+				proxy:    proxyURL,
+				noProxy:  noProxy,
+			}
+			proxyURL.User = nil
+		}
+		return func(r *http.Request) (*url.URL, error) {
+			// the negotiator opens the tunnels of HTTPS requests itself
+			if noProxy.match(r.URL) || (negotiator != nil && r.URL.Scheme == "https") {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}, negotiator, nil
+	}
+
+	if !c.FromEnvironment {
+		if c.NTLM {
+			return nil, nil, errors.New("proxy config: NTLM needs a proxy URL")
+		}
+		return nil, nil, nil
+	}
+	if c.NTLM {
+		return nil, nil, errors.New("proxy config: NTLM is not supported with FromEnvironment")
+	}
+	env := func(name string) string {
+		if value := getenv(name); value != "" {
+			return value
+		}
+		return getenv(strings.ToLower(name))
+	}
+	proxies := map[string]*url.URL{}
+	for scheme, name := range map[string]string{"https": "HTTPS_PROXY", "http": "HTTP_PROXY"} {
+		// HTTP_PROXY may be set by a client in CGI environments
+		if value := env(name); value != "" && (scheme != "http" || getenv("REQUEST_METHOD") == "") {
+			proxyURL, err := parseProxyURL(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			proxies[scheme] = proxyURL
+		}
+	}
+	noProxy = append(noProxy, parseNoProxy([]string{env("NO_PROXY")})...)
+	return func(r *http.Request) (*url.URL, error) {
+		proxyURL, ok := proxies[r.URL.Scheme]
+		if !ok || isLocalhost(r.URL.Hostname()) || noProxy.match(r.URL) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil, nil
+}
+
+func parseProxyURL(value string) (*url.URL, error) {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	proxyURL, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("proxy config: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("proxy config: unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy config: no host in proxy URL %q", proxyURL.Redacted())
+	}
+	return proxyURL, nil
+}
+
+func isLocalhost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type noProxyRule struct {
+	all    bool
+	domain string
+	ip     net.IP
+	ipNet  *net.IPNet
+	port   string
+}
+
+type noProxyRules []noProxyRule
+
+func parseNoProxy(entries []string) noProxyRules {
+	var rules noProxyRules
+	for _, entry := range entries {
+		for _, item := range strings.Split(entry, ",") {
+			item = strings.ToLower(strings.TrimSpace(item))
+			if item == "" {
+				continue
+			}
+			if item == "*" {
+				rules = append(rules, noProxyRule{all: true})
+				continue
+			}
+			if _, ipNet, err := net.ParseCIDR(item); err == nil {
+				rules = append(rules, noProxyRule{ipNet: ipNet})
+				continue
+			}
+			var rule noProxyRule
+			if host, port, err := net.SplitHostPort(item); err == nil {
+				item, rule.port = host, port
+			}
+			if ip := net.ParseIP(strings.Trim(item, "[]")); ip != nil {
+				rule.ip = ip
+			} else {
+				rule.domain = strings.TrimPrefix(strings.TrimPrefix(item, "*"), ".")
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func (rules noProxyRules) match(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	ip := net.ParseIP(host)
+	for _, rule := range rules {
+		switch {
+		case rule.port != "" && rule.port != port:
+		case rule.all:
+			return true
+		case rule.ipNet != nil:
+			if ip != nil && rule.ipNet.Contains(ip) {
+				return true
+			}
+		case rule.ip != nil:
+			if rule.ip.Equal(ip) {
+				return true
+			}
+		case host == rule.domain || strings.HasSuffix(host, "."+rule.domain):
+			return true
+		}
+	}
+	return false
+}
+
+// proxyNTLMNegotiator answers NTLM challenges of the proxy (407 with
+// Proxy-Authenticate: NTLM) for plain HTTP requests. The proxy authenticates
+// the connection, so later requests on it go through without a handshake.
+//
+// HTTPS requests are sent by the transport as direct ones, and dialContext
+// opens their connections with a CONNECT request to the proxy, doing the
+// handshake on the tunnel connection before handing it over for TLS.
+type proxyNTLMNegotiator struct {
+	next     http.RoundTripper
+	dial     func(ctx context.Context, network, address string) (net.Conn, error)
+	username string
+	password string
+	proxy    *url.URL
+	noProxy  noProxyRules
+}
+
+// proxyTunnelKey marks the context of HTTPS requests to send through a
+// CONNECT tunnel.
+type proxyTunnelKey struct{}
+
+func (n *proxyNTLMNegotiator) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" && !n.noProxy.match(req.URL) {
+		return n.next.RoundTrip(req.WithContext(context.WithValue(req.Context(), proxyTunnelKey{}, true)))
+	}
+	if req.URL.Scheme != "http" || req.Header.Get("Proxy-Authorization") != "" {
+		return n.next.RoundTrip(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		req.Body, _ = req.GetBody()
+	}
+
+	send := func(authorization string) (*http.Response, error) {
+		r, ok := rewindRequest(req)
+		if !ok {
+			return nil, errors.New("proxy ntlm: request body can not be replayed")
+		}
+		if authorization != "" {
+			r.Header.Set("Proxy-Authorization", authorization)
+		}
+		return n.next.RoundTrip(r)
+	}
+
+	resp, err := send("")
+	if err != nil || resp.StatusCode != http.StatusProxyAuthRequired || !hasNTLMChallenge(resp.Header) {
+		return resp, err
+	}
+	discardBody(resp)
+
+	username, domain, domainNeeded := ntlmssp.GetDomain(n.username)
+	negotiate, err := ntlmssp.NewNegotiateMessage(domain, "")
+	if err != nil {
+		return nil, fmt.Errorf("proxy ntlm: %w", err)
+	}
+	resp, err = send("NTLM " + base64.StdEncoding.EncodeToString(negotiate))
+	if err != nil || resp.StatusCode != http.StatusProxyAuthRequired {
+		return resp, err
+	}
+	challenge, ok := ntlmChallengeData(resp.Header)
+	if !ok {
+		return resp, nil
+	}
+	discardBody(resp)
+
+	authenticate, err := ntlmssp.ProcessChallenge(challenge, username, n.password, domainNeeded)
+	if err != nil {
+		return nil, fmt.Errorf("proxy ntlm: %w", err)
+	}
+	return send("NTLM " + base64.StdEncoding.EncodeToString(authenticate))
+}
+
+func (n *proxyNTLMNegotiator) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if ctx.Value(proxyTunnelKey{}) == nil {
+		return n.dial(ctx, network, address)
+	}
+	port := n.proxy.Port()
+	if port == "" {
+		port = "80"
+	}
+	conn, err := n.dial(ctx, network, net.JoinHostPort(n.proxy.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	tunnel, err := n.connect(ctx, conn, address)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// connect opens a tunnel to address on the proxy connection conn, starting
+// the NTLM handshake with the first CONNECT request.
+func (n *proxyNTLMNegotiator) connect(ctx context.Context, conn net.Conn, address string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	br := bufio.NewReader(conn)
+	send := func(authorization string) (*http.Response, error) {
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: address},
+			Host:   address,
+			Header: http.Header{"Proxy-Authorization": {authorization}},
+		}
+		if err := req.Write(conn); err != nil {
+			return nil, err
+		}
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			return nil, err
+		}
+		// the body of a successful response is the tunnel
+		if resp.StatusCode != http.StatusOK {
+			discardBody(resp)
+		}
+		return resp, nil
+	}
+
+	username, domain, domainNeeded := ntlmssp.GetDomain(n.username)
+	negotiate, err := ntlmssp.NewNegotiateMessage(domain, "")
+	if err != nil {
+		return nil, fmt.Errorf("proxy ntlm: %w", err)
+	}
+	resp, err := send("NTLM " + base64.StdEncoding.EncodeToString(negotiate))
+	if err != nil {
+		return nil, withTimeoutCause(ctx, fmt.Errorf("proxy ntlm: CONNECT %s: %w", address, err))
+	}
+	if resp.StatusCode == http.StatusProxyAuthRequired && !resp.Close {
+		if challenge, ok := ntlmChallengeData(resp.Header); ok {
+			authenticate, err := ntlmssp.ProcessChallenge(challenge, username, n.password, domainNeeded)
+			if err != nil {
+				return nil, fmt.Errorf("proxy ntlm: %w", err)
+			}
+			resp, err = send("NTLM " + base64.StdEncoding.EncodeToString(authenticate))
+			if err != nil {
+				return nil, withTimeoutCause(ctx, fmt.Errorf("proxy ntlm: CONNECT %s: %w", address, err))
+			}
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy ntlm: CONNECT %s: %s", address, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads what was buffered while reading the CONNECT response
+// before reading from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func hasNTLMChallenge(header http.Header) bool {
+	for _, value := range header.Values("Proxy-Authenticate") {
+		if strings.EqualFold(strings.TrimSpace(value), "NTLM") {
+			return true
+		}
+	}
+	return false
+}
+
+func ntlmChallengeData(header http.Header) ([]byte, bool) {
+	for _, value := range header.Values("Proxy-Authenticate") {
+		scheme, data, found := strings.Cut(strings.TrimSpace(value), " ")
+		if !found || !strings.EqualFold(scheme, "NTLM") {
+			continue
+		}
+		challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err == nil && len(challenge) > 0 {
+			return challenge, true
+		}
+	}
+	return nil, false
+}
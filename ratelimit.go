@@ -0,0 +1,253 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// rateLimitResetTime is the smallest reset value read as a Unix time rather
+// than seconds from now: 1e9 seconds are more than 31 years.
+const rateLimitResetTime = 1_000_000_000
+
+type RateLimitConfig struct {
+	Rate           float64
+	Burst          int
+	PerHostRate    float64
+	PerHostBurst   int
+	FailFast       bool
+	AdaptToServer  bool
+	MaxServerPause time.Duration
+	Now            func() time.Time
+}
+
+// RateLimitClient is a Client decorator limiting request rate with token
+// buckets: a global one (Rate requests per second, Burst at once) and one per
+// host (PerHostRate, PerHostBurst). Zero rate means no limit. Requests exceeding
+// the limit wait for a token, or fail with ErrRateLimited in FailFast mode or
+// when the context deadline comes before the token. With AdaptToServer, hosts
+// answering with Retry-After (429, 503) or exhausted RateLimit-Remaining are
+// paused until the advertised reset time, for at most MaxServerPause (15
+// minutes by default). A reset time is read as seconds from now, or as a Unix
+// time when it is 1e9 or more, as some servers send in X-RateLimit-Reset.
+type RateLimitClient struct {
+	Next           Client
+	FailFast       bool
+	AdaptToServer  bool
+	MaxServerPause time.Duration
+	PerHostRate    float64
+	PerHostBurst   int
+	Now            func() time.Time
+
+	sleep  func(ctx context.Context, d time.Duration) error
+	mu     sync.Mutex
+	global *tokenBucket
+	hosts  map[string]*tokenBucket
+}
+
+var _ Client = (*RateLimitClient)(nil)
+
+func NewRateLimitClient(cfg RateLimitConfig, next Client) (*RateLimitClient, error) {
+	if next == nil {
+		return nil, errors.New("rate limit client: next client is nil")
+	}
+	if cfg.Rate < 0 || cfg.PerHostRate < 0 {
+		return nil, fmt.Errorf("rate limit client: invalid rate %v/%v", cfg.Rate, cfg.PerHostRate)
+	}
+	if cfg.MaxServerPause < 0 {
+		return nil, fmt.Errorf("rate limit client: invalid max server pause %v", cfg.MaxServerPause)
+	}
+
+	c := &RateLimitClient{
+		Next:           next,
+		FailFast:       cfg.FailFast,
+		AdaptToServer:  cfg.AdaptToServer,
+		MaxServerPause: cfg.MaxServerPause,
+		PerHostRate:    cfg.PerHostRate,
+		PerHostBurst:   cfg.PerHostBurst,
+		Now:            cfg.Now,
+		sleep:          sleepContext,
+		hosts:          make(map[string]*tokenBucket),
+	}
+	if c.MaxServerPause == 0 {
+		c.MaxServerPause = 15 * time.Minute
+	}
+	if c.Now == nil {
+		c.Now = time.Now
+	}
+	c.global = newTokenBucket(cfg.Rate, cfg.Burst, c.Now())
+	return c, nil
+}
+
+func (c *RateLimitClient) PerformRequest(ctx context.Context, req Request, resp Response) error {
+	host := requestHost(req)
+	if err := c.wait(ctx, host); err != nil {
+		return err
+	}
+
+	if !c.AdaptToServer {
+		return c.Next.PerformRequest(ctx, req, resp)
+	}
+
+	err := c.Next.PerformRequest(ctx, req, &rateLimitResponse{Response: resp, client: c, host: host})
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		c.adapt(host, statusErr.StatusCode, statusErr.Header)
+	}
+	return err
+}
+
+func (c *RateLimitClient) wait(ctx context.Context, host string) error {
+	c.mu.Lock()
+	now := c.Now()
+	hostBucket := c.hostBucket(host, now)
+	delay := max(c.global.reserve(now), hostBucket.reserve(now))
+
+	if delay > 0 {
+		deadline, hasDeadline := ctx.Deadline()
+		if c.FailFast || (hasDeadline && deadline.Sub(now) < delay) {
+			c.global.cancel(now)
+			hostBucket.cancel(now)
+			c.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrRateLimited, host)
+		}
+	}
+	c.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	if err := c.sleep(ctx, delay); err != nil {
+		c.mu.Lock()
+		now := c.Now()
+		c.global.cancel(now)
+		hostBucket.cancel(now)
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (c *RateLimitClient) hostBucket(host string, now time.Time) *tokenBucket {
+	b, ok := c.hosts[host]
+	if !ok {
+		b = newTokenBucket(c.PerHostRate, c.PerHostBurst, now)
+		c.hosts[host] = b
+	}
+	return b
+}
+
+// adapt pauses host according to rate limit headers sent by the server.
+func (c *RateLimitClient) adapt(host string, statusCode int, header http.Header) {
+	now := c.Now()
+	var pause time.Duration
+	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+		pause, _ = parseRetryAfter(header.Get("Retry-After"), now)
+	}
+	if remaining, ok := rateLimitHeader(header, "Remaining"); ok && remaining <= 0 {
+		if reset, ok := rateLimitHeader(header, "Reset"); ok && reset > 0 {
+			if reset >= rateLimitResetTime {
+				// a reset time already past means no pause
+				pause = max(pause, time.Unix(reset, 0).Sub(now))
+			} else {
+				pause = max(pause, time.Duration(reset)*time.Second)
+			}
+		}
+	}
+	if pause <= 0 {
+		return
+	}
+	pause = min(pause, c.MaxServerPause)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.hostBucket(host, now)
+	if until := now.Add(pause); until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+// rateLimitHeader reads RateLimit-<name> or the older X-RateLimit-<name>.
+func rateLimitHeader(header http.Header, name string) (int64, bool) {
+	for _, key := range []string{"RateLimit-" + name, "X-RateLimit-" + name} {
+		if value := header.Get(key); value != "" {
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+type rateLimitResponse struct {
+	Response
+	client *RateLimitClient
+	host   string
+}
+
+func (r *rateLimitResponse) ProcessResponse(netResp *http.Response) error {
+	r.client.adapt(r.host, netResp.StatusCode, netResp.Header)
+	return r.Response.ProcessResponse(netResp)
+}
+
+func (r *rateLimitResponse) Unwrap() Response {
+	return r.Response
+}
+
+// tokenBucket holds up to burst tokens refilled at rate tokens per second.
+// Tokens may go negative: that is the debt of requests waiting for their turn.
+// Zero rate disables the limit, leaving only server-requested pauses.
+type tokenBucket struct {
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	var delay time.Duration
+	if now.Before(b.pausedUntil) {
+		delay = b.pausedUntil.Sub(now)
+	}
+	if b.rate <= 0 {
+		return delay
+	}
+
+	b.refill(now)
+	b.tokens--
+	if b.tokens < 0 {
+		delay = max(delay, time.Duration(-b.tokens/b.rate*float64(time.Second)))
+	}
+	return delay
+}
+
+// cancel returns a token taken by reserve.
+func (b *tokenBucket) cancel(now time.Time) {
+	if b.rate <= 0 {
+		return
+	}
+	b.refill(now)
+	b.tokens = min(b.tokens+1, b.burst)
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed.Seconds()*b.rate, b.burst)
+		b.last = now
+	}
+}
@@ -0,0 +1,202 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRateLimitClient(t *testing.T, cfg RateLimitConfig, next Client) (*RateLimitClient, *fakeClock, *[]time.Duration) {
+	clock := newFakeClock()
+	cfg.Now = clock.Now
+	client, newError := NewRateLimitClient(cfg, next)
+	require.NoError(t, newError)
+
+	var waits []time.Duration
+	client.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		clock.Advance(d)
+		return ctx.Err()
+	}
+	return client, clock, &waits
+}
+
+func successClient(t *testing.T) *MockClient {
+	next := NewMockClient(t)
+	next.EXPECT().PerformRequest(mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	return next
+}
+
+func TestRateLimitBlocking(t *testing.T) {
+	client, _, waits := newTestRateLimitClient(t, RateLimitConfig{Rate: 10, Burst: 2}, successClient(t))
+
+	for _, url := range []string{"http://a.example/", "http://b.example/", "http://a.example/", "http://b.example/"} {
+		assert.NoError(t, client.PerformRequest(context.Background(), testGet(url), nil))
+	}
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}, *waits)
+}
+
+func TestRateLimitPerHost(t *testing.T) {
+	client, _, waits := newTestRateLimitClient(t, RateLimitConfig{PerHostRate: 2, PerHostBurst: 1}, successClient(t))
+
+	for _, url := range []string{"http://a.example/", "http://b.example/", "http://a.example/", "http://c.example/"} {
+		assert.NoError(t, client.PerformRequest(context.Background(), testGet(url), nil))
+	}
+	assert.Equal(t, []time.Duration{500 * time.Millisecond}, *waits)
+}
+
+func TestRateLimitFailFast(t *testing.T) {
+	client, clock, waits := newTestRateLimitClient(t, RateLimitConfig{Rate: 1, PerHostRate: 1, FailFast: true}, successClient(t))
+	req := testGet("http://a.example/")
+
+	assert.NoError(t, client.PerformRequest(context.Background(), req, nil))
+	gotError := client.PerformRequest(context.Background(), req, nil)
+	assert.True(t, errors.Is(gotError, ErrRateLimited))
+	assert.Contains(t, gotError.Error(), "a.example")
+
+	// rejected requests do not consume tokens
+	clock.Advance(time.Second)
+	assert.NoError(t, client.PerformRequest(context.Background(), req, nil))
+	assert.Empty(t, *waits)
+}
+
+func TestRateLimitContext(t *testing.T) {
+	client, clock, waits := newTestRateLimitClient(t, RateLimitConfig{Rate: 1}, successClient(t))
+	req := testGet("http://a.example/")
+	assert.NoError(t, client.PerformRequest(context.Background(), req, nil))
+
+	// the deadline is compared with Now
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(100*time.Millisecond))
+	defer cancel()
+	assert.ErrorIs(t, client.PerformRequest(ctx, req, nil), ErrRateLimited)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, client.PerformRequest(ctx, req, nil), context.Canceled)
+	assert.Equal(t, []time.Duration{time.Second}, *waits)
+}
+
+func TestRateLimitAdaptToServer(t *testing.T) {
+	now := newFakeClock().Now().Unix()
+	for _, tc := range []struct {
+		Name          string
+		Config        RateLimitConfig
+		Status        int
+		Header        http.Header
+		AsStatusError bool
+		WantWait      time.Duration
+	}{
+		{
+			Name:     "retry after",
+			Status:   http.StatusTooManyRequests,
+			Header:   http.Header{"Retry-After": []string{"5"}},
+			WantWait: 5 * time.Second,
+		},
+		{
+			Name:          "retry after in status error",
+			Status:        http.StatusServiceUnavailable,
+			Header:        http.Header{"Retry-After": []string{"7"}},
+			AsStatusError: true,
+			WantWait:      7 * time.Second,
+		},
+		{
+			Name:     "retry after ignored on success",
+			Status:   http.StatusOK,
+			Header:   http.Header{"Retry-After": []string{"5"}},
+			WantWait: 0,
+		},
+		{
+			Name:     "ratelimit headers",
+			Status:   http.StatusOK,
+			Header:   http.Header{"Ratelimit-Remaining": []string{"0"}, "Ratelimit-Reset": []string{"3"}},
+			WantWait: 3 * time.Second,
+		},
+		{
+			Name:     "x-ratelimit headers",
+			Status:   http.StatusOK,
+			Header:   http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{"2"}},
+			WantWait: 2 * time.Second,
+		},
+		{
+			Name:     "x-ratelimit unix time reset",
+			Status:   http.StatusOK,
+			Header:   http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{strconv.FormatInt(now+90, 10)}},
+			WantWait: 90 * time.Second,
+		},
+		{
+			Name:   "x-ratelimit unix time reset now",
+			Status: http.StatusOK,
+			Header: http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{strconv.FormatInt(now, 10)}},
+		},
+		{
+			Name:   "x-ratelimit unix time reset past",
+			Status: http.StatusOK,
+			Header: http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{"1700000000"}},
+		},
+		{
+			Name:     "far reset capped",
+			Status:   http.StatusOK,
+			Header:   http.Header{"X-Ratelimit-Remaining": []string{"0"}, "X-Ratelimit-Reset": []string{"4102444800"}},
+			WantWait: 15 * time.Minute,
+		},
+		{
+			Name:     "retry after capped",
+			Config:   RateLimitConfig{MaxServerPause: time.Minute},
+			Status:   http.StatusTooManyRequests,
+			Header:   http.Header{"Retry-After": []string{"86400"}},
+			WantWait: time.Minute,
+		},
+		{
+			Name:     "quota left",
+			Status:   http.StatusOK,
+			Header:   http.Header{"Ratelimit-Remaining": []string{"10"}, "Ratelimit-Reset": []string{"3"}},
+			WantWait: 0,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			next := NewMockClient(t)
+			next.EXPECT().PerformRequest(mock.Anything, mock.Anything, mock.Anything).RunAndReturn(
+				func(ctx context.Context, req Request, res Response) error {
+					if tc.AsStatusError {
+						return &StatusError{StatusCode: tc.Status, Header: tc.Header}
+					}
+					return res.ProcessResponse(&http.Response{StatusCode: tc.Status, Header: tc.Header})
+				}).Once()
+			next.EXPECT().PerformRequest(mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			tc.Config.AdaptToServer = true
+			client, _, waits := newTestRateLimitClient(t, tc.Config, next)
+
+			resp := NewMockResponse(t)
+			resp.EXPECT().ProcessResponse(mock.Anything).Return(nil).Maybe()
+
+			client.PerformRequest(context.Background(), testGet("http://a.example/"), resp)
+			assert.NoError(t, client.PerformRequest(context.Background(), testGet("http://b.example/"), nil))
+			assert.NoError(t, client.PerformRequest(context.Background(), testGet("http://a.example/"), nil))
+
+			if tc.WantWait == 0 {
+				assert.Empty(t, *waits)
+			} else {
+				assert.Equal(t, []time.Duration{tc.WantWait}, *waits)
+			}
+		})
+	}
+}
+
+func TestRateLimitRealTime(t *testing.T) {
+	client, newError := NewRateLimitClient(RateLimitConfig{Rate: 100, Burst: 1}, successClient(t))
+	require.NoError(t, newError)
+
+	started := time.Now()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, client.PerformRequest(context.Background(), testGet("http://a.example/"), nil))
+	}
+	assert.GreaterOrEqual(t, time.Since(started), 25*time.Millisecond)
+}
@@ -0,0 +1,150 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrTooManyRedirects  = errors.New("too many redirects")
+	ErrRedirectForbidden = errors.New("redirect forbidden by policy")
+)
+
+// RedirectPolicy controls how clients built with NewNetHTTPClient follow
+// redirects.
+//
+// MaxHops limits the number of redirects, 10 by default. SameHostOnly and
+// SameSchemeOnly reject redirects to another host or scheme than the one of
+// the original request. On redirects to another origin, Authorization,
+// Proxy-Authorization and Cookie are removed along with StripHeaders; a cookie
+// jar adds back the cookies of the new origin. PreserveMethod resends the
+// method and body of the request on 301 and 302 instead of switching to GET.
+type RedirectPolicy struct {
+	MaxHops        int
+	SameHostOnly   bool
+	SameSchemeOnly bool
+	StripHeaders   []string
+	PreserveMethod bool
+}
+
+var (
+	redirectSensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+	// net/http drops these along with the body when switching to GET
+	redirectBodyHeaders = []string{"Content-Encoding", "Content-Language", "Content-Location", "Content-Type"}
+)
+
+func (p *RedirectPolicy) check(req *http.Request, via []*http.Request) error {
+	maxHops := p.MaxHops
+	if maxHops <= 0 {
+		maxHops = 10
+	}
+	if len(via) > maxHops {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, len(via))
+	}
+
+	original := via[0]
+	if p.SameHostOnly && !strings.EqualFold(req.URL.Hostname(), original.URL.Hostname()) {
+		return fmt.Errorf("%w: %s is not on host %s", ErrRedirectForbidden, req.URL.Redacted(), original.URL.Hostname())
+	}
+	if p.SameSchemeOnly && !strings.EqualFold(req.URL.Scheme, original.URL.Scheme) {
+		return fmt.Errorf("%w: %s is not %s", ErrRedirectForbidden, req.URL.Redacted(), original.URL.Scheme)
+	}
+
+	if !sameOrigin(req, original) {
+		for _, name := range redirectSensitiveHeaders {
+			req.Header.Del(name)
+		}
+		for _, name := range p.StripHeaders {
+			req.Header.Del(name)
+		}
+	}
+
+	previous := via[len(via)-1]
+	status := req.Response.StatusCode
+	if p.PreserveMethod && (status == http.StatusMovedPermanently || status == http.StatusFound) && req.Method != previous.Method {
+		req.Method = previous.Method
+		if original.Body != nil && original.Body != http.NoBody {
+			if original.GetBody == nil {
+				return fmt.Errorf("%w: request body can not be sent again", ErrRedirectForbidden)
+			}
+			body, err := original.GetBody()
+			if err != nil {
+				return err
+			}
+			req.Body, req.GetBody, req.ContentLength = body, original.GetBody, original.ContentLength
+		}
+		for _, name := range redirectBodyHeaders {
+			if values, ok := original.Header[name]; ok && req.Header.Get(name) == "" {
+				req.Header[name] = values
+			}
+		}
+	}
+	return nil
+}
+
+func sameOrigin(a, b *http.Request) bool {
+	return strings.EqualFold(a.URL.Scheme, b.URL.Scheme) && strings.EqualFold(hostPort(a), hostPort(b))
+}
+
+func hostPort(r *http.Request) string {
+	if port := r.URL.Port(); port != "" {
+		return r.URL.Host
+	}
+	return r.URL.Host + ":" + map[string]string{"http": "80", "https": "443"}[strings.ToLower(r.URL.Scheme)]
+}
+
+type redirectPolicyKey struct{}
+
+func withRedirectPolicy(ctx context.Context, policy *RedirectPolicy) context.Context {
+	return context.WithValue(ctx, redirectPolicyKey{}, policy)
+}
+
+// checkRedirect applies the redirect settings of cfg unless the request
+// context carries per-request overrides.
+func checkRedirect(cfg Config) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		follow := cfg.FollowRedirect || cfg.RedirectPolicy != nil
+		policy := cfg.RedirectPolicy
+		if override, ok := req.Context().Value(redirectPolicyKey{}).(*RedirectPolicy); ok {
+			follow, policy = true, override
+		}
+		if override, ok := followRedirectFromContext(req.Context()); ok {
+			follow = override
+		}
+		if !follow {
+			return http.ErrUseLastResponse
+		}
+		if policy == nil {
+			policy = &RedirectPolicy{}
+		}
+		return policy.check(req, via)
+	}
+}
+
+// Redirect is a redirect response received while performing a request.
+type Redirect struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Location   string
+}
+
+// RedirectChain returns the redirects followed to get r, oldest first. Call
+// it from Response.ProcessResponse to log the chain.
+func RedirectChain(r *http.Response) []Redirect {
+	var chain []Redirect
+	for req := r.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		redirect := Redirect{StatusCode: req.Response.StatusCode, Location: req.URL.Redacted()}
+		if from := req.Response.Request; from != nil {
+			redirect.Method, redirect.URL = from.Method, from.URL.Redacted()
+		}
+		chain = append(chain, redirect)
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
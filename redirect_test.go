@@ -0,0 +1,222 @@
+package httpoh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type redirectTestRequest struct {
+	method  string
+	url     string
+	header  http.Header
+	body    string
+	options RequestOptions
+}
+
+func (r *redirectTestRequest) Method() string          { return r.method }
+func (r *redirectTestRequest) URL() string             { return r.url }
+func (r *redirectTestRequest) Headers() http.Header    { return r.header }
+func (r *redirectTestRequest) Options() RequestOptions { return r.options }
+func (r *redirectTestRequest) Body() io.Reader {
+	if r.body == "" {
+		return nil
+	}
+	return strings.NewReader(r.body)
+}
+
+type redirectTestResponse struct {
+	rawBodyResponse
+	chain []Redirect
+}
+
+func (r *redirectTestResponse) ProcessResponse(netResp *http.Response) error {
+	r.chain = RedirectChain(netResp)
+	return r.rawBodyResponse.ProcessResponse(netResp)
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s body=%q type=%q auth=%q key=%q other=%q",
+			r.Method, r.URL.Path, body, r.Header.Get("Content-Type"),
+			r.Header.Get("Authorization"), r.Header.Get("X-Api-Key"), r.Header.Get("X-Other"))
+	})
+	other := httptest.NewServer(echo)
+	defer other.Close()
+	otherTLS := httptest.NewTLSServer(echo)
+	defer otherTLS.Close()
+	otherHost := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/hops/"):
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/hops/"))
+			if n > 0 {
+				http.Redirect(w, r, "/hops/"+strconv.Itoa(n-1), http.StatusFound)
+				return
+			}
+			echo(w, r)
+		case r.URL.Path == "/to":
+			code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+			http.Redirect(w, r, r.URL.Query().Get("url"), code)
+		default:
+			echo(w, r)
+		}
+	}))
+	defer server.Close()
+	to := func(code int, url string) string {
+		return fmt.Sprintf("%s/to?code=%d&url=%s", server.URL, code, url)
+	}
+	noFollow := false
+
+	for _, tc := range []struct {
+		Name      string
+		Config    Config
+		Options   RequestOptions
+		Method    string
+		URL       string
+		WantBody  string
+		WantChain []Redirect
+		WantError error
+	}{
+		{
+			Name:     "chain",
+			Config:   Config{RedirectPolicy: &RedirectPolicy{}},
+			URL:      server.URL + "/hops/2",
+			WantBody: `GET /hops/0 body="" type="" auth="token" key="key" other="other"`,
+			WantChain: []Redirect{
+				{Method: http.MethodGet, URL: server.URL + "/hops/2", StatusCode: http.StatusFound, Location: server.URL + "/hops/1"},
+				{Method: http.MethodGet, URL: server.URL + "/hops/1", StatusCode: http.StatusFound, Location: server.URL + "/hops/0"},
+			},
+		},
+		{
+			Name:      "max hops",
+			Config:    Config{RedirectPolicy: &RedirectPolicy{MaxHops: 3}},
+			URL:       server.URL + "/hops/4",
+			WantError: ErrTooManyRedirects,
+		},
+		{
+			Name:      "default max hops",
+			Config:    Config{FollowRedirect: true},
+			URL:       server.URL + "/hops/11",
+			WantError: ErrTooManyRedirects,
+		},
+		{
+			Name:      "same host only",
+			Config:    Config{RedirectPolicy: &RedirectPolicy{SameHostOnly: true}},
+			URL:       to(http.StatusFound, otherHost),
+			WantError: ErrRedirectForbidden,
+		},
+		{
+			Name:     "same host on other port",
+			Config:   Config{RedirectPolicy: &RedirectPolicy{SameHostOnly: true, SameSchemeOnly: true, StripHeaders: []string{"X-Api-Key"}}},
+			URL:      to(http.StatusFound, other.URL+"/other"),
+			WantBody: `GET /other body="" type="" auth="" key="" other="other"`,
+			WantChain: []Redirect{
+				{Method: http.MethodGet, URL: to(http.StatusFound, other.URL+"/other"), StatusCode: http.StatusFound, Location: other.URL + "/other"},
+			},
+		},
+		{
+			Name:      "same scheme only",
+			Config:    Config{RedirectPolicy: &RedirectPolicy{SameSchemeOnly: true}, InsecureSkipVerify: true},
+			URL:       to(http.StatusFound, otherTLS.URL),
+			WantError: ErrRedirectForbidden,
+		},
+		{
+			Name:     "other scheme",
+			Config:   Config{RedirectPolicy: &RedirectPolicy{}, InsecureSkipVerify: true},
+			URL:      to(http.StatusFound, otherTLS.URL+"/secure"),
+			WantBody: `GET /secure body="" type="" auth="" key="key" other="other"`,
+			WantChain: []Redirect{
+				{Method: http.MethodGet, URL: to(http.StatusFound, otherTLS.URL+"/secure"), StatusCode: http.StatusFound, Location: otherTLS.URL + "/secure"},
+			},
+		},
+		{
+			Name:     "post switched to get",
+			Config:   Config{RedirectPolicy: &RedirectPolicy{}},
+			Method:   http.MethodPost,
+			URL:      to(http.StatusFound, "/new"),
+			WantBody: `GET /new body="" type="" auth="token" key="key" other="other"`,
+			WantChain: []Redirect{
+				{Method: http.MethodPost, URL: to(http.StatusFound, "/new"), StatusCode: http.StatusFound, Location: server.URL + "/new"},
+			},
+		},
+		{
+			Name:     "post preserved on 301",
+			Config:   Config{RedirectPolicy: &RedirectPolicy{PreserveMethod: true}},
+			Method:   http.MethodPost,
+			URL:      to(http.StatusMovedPermanently, "/new"),
+			WantBody: `POST /new body="payload" type="text/plain" auth="token" key="key" other="other"`,
+			WantChain: []Redirect{
+				{Method: http.MethodPost, URL: to(http.StatusMovedPermanently, "/new"), StatusCode: http.StatusMovedPermanently, Location: server.URL + "/new"},
+			},
+		},
+		{
+			Name:     "post switched to get on 303",
+			Config:   Config{RedirectPolicy: &RedirectPolicy{PreserveMethod: true}},
+			Method:   http.MethodPost,
+			URL:      to(http.StatusSeeOther, "/new"),
+			WantBody: `GET /new body="" type="" auth="token" key="key" other="other"`,
+			WantChain: []Redirect{
+				{Method: http.MethodPost, URL: to(http.StatusSeeOther, "/new"), StatusCode: http.StatusSeeOther, Location: server.URL + "/new"},
+			},
+		},
+		{
+			Name:     "request policy",
+			Options:  RequestOptions{RedirectPolicy: &RedirectPolicy{MaxHops: 1}},
+			URL:      server.URL + "/hops/1",
+			WantBody: `GET /hops/0 body="" type="" auth="token" key="key" other="other"`,
+			WantChain: []Redirect{
+				{Method: http.MethodGet, URL: server.URL + "/hops/1", StatusCode: http.StatusFound, Location: server.URL + "/hops/0"},
+			},
+		},
+		{
+			Name:     "request policy not followed",
+			Options:  RequestOptions{RedirectPolicy: &RedirectPolicy{}, FollowRedirect: &noFollow},
+			URL:      server.URL + "/hops/1",
+			WantBody: "<a href=\"/hops/0\">Found</a>.\n\n",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			httpClient, err := NewNetHTTPClient(tc.Config)
+			require.NoError(t, err)
+			defer httpClient.CloseIdleConnections()
+			client, newError := NewClientNative(tc.Config, httpClient)
+			require.NoError(t, newError)
+
+			req := &redirectTestRequest{
+				method: http.MethodGet,
+				url:    tc.URL,
+				header: http.Header{
+					"Authorization": {"token"},
+					"X-Api-Key":     {"key"},
+					"X-Other":       {"other"},
+				},
+				options: tc.Options,
+			}
+			if tc.Method == http.MethodPost {
+				req.method, req.body = tc.Method, "payload"
+				req.header.Set("Content-Type", "text/plain")
+			}
+			resp := &redirectTestResponse{}
+
+			err = client.PerformRequest(context.Background(), req, resp)
+			if tc.WantError != nil {
+				assert.ErrorIs(t, err, tc.WantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.WantBody, resp.body)
+			assert.Equal(t, tc.WantChain, resp.chain)
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// BackoffPolicy computes how long to wait before the next attempt. Attempt is
+// the number of attempts already made (starting at 1), prev is the delay
+// returned for the previous retry or zero before the first one.
+type BackoffPolicy interface {
+	Backoff(attempt int, prev time.Duration) time.Duration
+}
+
+// ExponentialBackoff waits Base, Base*Multiplier, Base*Multiplier^2, ... capped by Max.
+type ExponentialBackoff struct {
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+var _ BackoffPolicy = ExponentialBackoff{}
+
+func (b ExponentialBackoff) Backoff(attempt int, _ time.Duration) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(b.Base)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if b.Max > 0 && d >= float64(b.Max) {
+			return b.Max
+		}
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		return b.Max
+	}
+	return time.Duration(d)
+}
+
+// DecorrelatedJitterBackoff picks a random delay between Base and three times
+// the previous delay, capped by Max.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+var _ BackoffPolicy = DecorrelatedJitterBackoff{}
+
+func (b DecorrelatedJitterBackoff) Backoff(_ int, prev time.Duration) time.Duration {
+	if prev < b.Base {
+		prev = b.Base
+	}
+	upper := prev * 3
+	if b.Max > 0 && upper > b.Max {
+		upper = b.Max
+	}
+	if upper <= b.Base {
+		return upper
+	}
+	return b.Base + rand.N(upper-b.Base+1)
+}
+
+type RetryConfig struct {
+	MaxAttempts      int
+	Backoff          BackoffPolicy
+	RetryOnStatus    []int
+	IgnoreRetryAfter bool
+	MaxRetryAfter    time.Duration
+	IsRetryableError func(error) bool
+	// RetryNonIdempotent repeats requests with any method.
+	RetryNonIdempotent bool
+}
+
+// RetryClient is a Client decorator repeating failed requests. A request is
+// repeated when the next client returns an error accepted by IsRetryableError
+// or when the response status is one of RetryOnStatus, either seen by
+// ProcessResponse or reported as *StatusError. ProcessResponse is called once,
+// for the response that is not retried, and errors it returns end the request.
+//
+// Only requests with an idempotent method (GET, HEAD, OPTIONS, TRACE, PUT,
+// DELETE) are repeated, unless they are marked with RequestOptions.Idempotent
+// or RetryNonIdempotent is set. Requests with a one-shot body
+// (RequestWithBody) are never repeated, implement RequestWithReplayableBody to
+// make them retryable.
+type RetryClient struct {
+	Next               Client
+	MaxAttempts        int
+	Backoff            BackoffPolicy
+	RetryOnStatus      map[int]bool
+	IgnoreRetryAfter   bool
+	MaxRetryAfter      time.Duration
+	IsRetryableError   func(error) bool
+	RetryNonIdempotent bool
+}
+
+var _ Client = (*RetryClient)(nil)
+
+func NewRetryClient(cfg RetryConfig, next Client) (*RetryClient, error) {
+	if next == nil {
+		return nil, errors.New("retry client: next client is nil")
+	}
+	if cfg.MaxAttempts < 0 {
+		return nil, fmt.Errorf("retry client: invalid max attempts %d", cfg.MaxAttempts)
+	}
+
+	c := &RetryClient{
+		Next:               next,
+		MaxAttempts:        cfg.MaxAttempts,
+		Backoff:            cfg.Backoff,
+		RetryOnStatus:      make(map[int]bool),
+		IgnoreRetryAfter:   cfg.IgnoreRetryAfter,
+		MaxRetryAfter:      cfg.MaxRetryAfter,
+		IsRetryableError:   cfg.IsRetryableError,
+		RetryNonIdempotent: cfg.RetryNonIdempotent,
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = 3
+	}
+	if c.Backoff == nil {
+		c.Backoff = defaultBackoff()
+	}
+	if c.IsRetryableError == nil {
+		c.IsRetryableError = IsTransientError
+	}
+	retryOnStatus := cfg.RetryOnStatus
+	if retryOnStatus == nil {
+		retryOnStatus = DefaultRetryOnStatus()
+	}
+	for _, code := range retryOnStatus {
+		c.RetryOnStatus[code] = true
+	}
+	return c, nil
+}
+
+func defaultBackoff() BackoffPolicy {
+	return ExponentialBackoff{Base: 100 * time.Millisecond, Max: 5 * time.Second, Multiplier: 2}
+}
+
+func DefaultRetryOnStatus() []int {
+	return []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+}
+
+func (c *RetryClient) PerformRequest(ctx context.Context, req Request, resp Response) error {
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		last := attempt >= c.MaxAttempts || !c.retryable(req)
+		rResp := &retryResponse{Response: resp, retryOn: c.RetryOnStatus, last: last}
+		err := c.Next.PerformRequest(withAttempt(ctx, attempt), req, rResp)
+		if err == nil || last || rResp.processed || ctx.Err() != nil {
+			return err
+		}
+
+		var retryAfter time.Duration
+		var statusErr *StatusError
+		switch {
+		case errors.As(err, &statusErr) && c.RetryOnStatus[statusErr.StatusCode]:
+			retryAfter, _ = parseRetryAfter(statusErr.Header.Get("Retry-After"), time.Now())
+		case c.IsRetryableError(err):
+		default:
+			return err
+		}
+
+		delay = c.Backoff.Backoff(attempt, delay)
+		if !c.IgnoreRetryAfter && retryAfter > 0 {
+			if c.MaxRetryAfter > 0 && retryAfter > c.MaxRetryAfter {
+				retryAfter = c.MaxRetryAfter
+			}
+			delay = retryAfter
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// retryable reports whether req may be sent more than once.
+func (c *RetryClient) retryable(req Request) bool {
+	if !canResend(req) {
+		return false
+	}
+	if c.RetryNonIdempotent || requestOptions(req).Idempotent {
+		return true
+	}
+	switch req.Method() {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+type attemptKey struct{}
+
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// attemptFromContext returns the RetryClient attempt number, 1 for the first
+// attempt and for requests sent without RetryClient.
+func attemptFromContext(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+func canResend(req Request) bool {
+	if _, replayable := req.(RequestWithReplayableBody); replayable {
+		return true
+	}
+	_, oneShotBody := req.(RequestWithBody)
+	return !oneShotBody
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryResponse hides responses with retryable status from the wrapped
+// Response unless this is the last attempt. processed reports whether the
+// wrapped Response got the response.
+type retryResponse struct {
+	Response
+	retryOn   map[int]bool
+	last      bool
+	processed bool
+}
+
+func (r *retryResponse) ProcessResponse(netResp *http.Response) error {
+	if r.last || !r.retryOn[netResp.StatusCode] {
+		r.processed = true
+		return r.Response.ProcessResponse(netResp)
+	}
+
+	return newStatusError(netResp, 0)
+}
+
+func (r *retryResponse) Unwrap() Response {
+	return r.Response
+}
+
+// parseRetryAfter understands both forms of Retry-After: delay in seconds and HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		d := at.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// IsTransientError reports whether err looks like a network failure that may
+// go away on its own: timeouts, refused or reset connections, unexpected EOF
+// and temporary DNS failures. Cancelled contexts are never transient.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	for _, transient := range []error{
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.ECONNABORTED,
+		syscall.EPIPE,
+		io.ErrUnexpectedEOF,
+		io.EOF,
+	} {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	return false
+}
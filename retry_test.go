@@ -0,0 +1,368 @@
+package httpoh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryClient(t *testing.T) {
+	for _, tc := range []struct {
+		Name           string
+		Config         RetryConfig
+		ServerStatus   []int
+		ServerHeaders  http.Header
+		ServerStopped  bool
+		Timeout        time.Duration
+		WantCalls      int
+		WantStatus     int
+		WantErrorMatch []string
+	}{
+		{
+			Name:         "success on first attempt",
+			Config:       RetryConfig{Backoff: ExponentialBackoff{Base: time.Millisecond}},
+			ServerStatus: []int{http.StatusOK},
+			WantCalls:    1,
+			WantStatus:   http.StatusOK,
+		},
+		{
+			Name:         "success after retryable statuses",
+			Config:       RetryConfig{MaxAttempts: 3, Backoff: ExponentialBackoff{Base: time.Millisecond}},
+			ServerStatus: []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			WantCalls:    3,
+			WantStatus:   http.StatusOK,
+		},
+		{
+			Name:         "attempts exhausted",
+			Config:       RetryConfig{MaxAttempts: 2, Backoff: ExponentialBackoff{Base: time.Millisecond}},
+			ServerStatus: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			WantCalls:    2,
+			WantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			Name:         "non retryable status",
+			Config:       RetryConfig{MaxAttempts: 3, Backoff: ExponentialBackoff{Base: time.Millisecond}},
+			ServerStatus: []int{http.StatusInternalServerError, http.StatusOK},
+			WantCalls:    1,
+			WantStatus:   http.StatusInternalServerError,
+		},
+		{
+			Name: "custom retry status set",
+			Config: RetryConfig{
+				MaxAttempts:   3,
+				Backoff:       ExponentialBackoff{Base: time.Millisecond},
+				RetryOnStatus: []int{http.StatusInternalServerError},
+			},
+			ServerStatus: []int{http.StatusInternalServerError, http.StatusOK},
+			WantCalls:    2,
+			WantStatus:   http.StatusOK,
+		},
+		{
+			Name:          "retry after longer than deadline",
+			Config:        RetryConfig{MaxAttempts: 3, Backoff: ExponentialBackoff{Base: time.Millisecond}},
+			ServerStatus:  []int{http.StatusTooManyRequests, http.StatusOK},
+			ServerHeaders: http.Header{"Retry-After": []string{"10"}},
+			Timeout:       time.Second,
+			WantCalls:     1,
+			WantErrorMatch: []string{
+				"unexpected response status 429",
+			},
+		},
+		{
+			Name: "retry after ignored",
+			Config: RetryConfig{
+				MaxAttempts:      3,
+				Backoff:          ExponentialBackoff{Base: time.Millisecond},
+				IgnoreRetryAfter: true,
+			},
+			ServerStatus:  []int{http.StatusTooManyRequests, http.StatusOK},
+			ServerHeaders: http.Header{"Retry-After": []string{"10"}},
+			Timeout:       time.Second,
+			WantCalls:     2,
+			WantStatus:    http.StatusOK,
+		},
+		{
+			Name: "retry after capped",
+			Config: RetryConfig{
+				MaxAttempts:   3,
+				Backoff:       ExponentialBackoff{Base: time.Millisecond},
+				MaxRetryAfter: time.Millisecond,
+			},
+			ServerStatus:  []int{http.StatusTooManyRequests, http.StatusOK},
+			ServerHeaders: http.Header{"Retry-After": []string{"10"}},
+			Timeout:       time.Second,
+			WantCalls:     2,
+			WantStatus:    http.StatusOK,
+		},
+		{
+			Name:           "connection refused",
+			Config:         RetryConfig{MaxAttempts: 2, Backoff: ExponentialBackoff{Base: time.Millisecond}},
+			ServerStopped:  true,
+			WantErrorMatch: []string{"connection refused"},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := int(calls.Add(1))
+				for name, values := range tc.ServerHeaders {
+					w.Header()[name] = values
+				}
+				w.WriteHeader(tc.ServerStatus[call-1])
+				fmt.Fprintf(w, "attempt %d", call)
+			}))
+			defer server.Close()
+
+			native, newError := NewClientNative(Config{}, server.Client())
+			require.NoError(t, newError)
+			client, newError := NewRetryClient(tc.Config, native)
+			require.NoError(t, newError)
+
+			req := NewMockRequest(t)
+			req.EXPECT().URL().Return(server.URL)
+			req.EXPECT().Method().Return(http.MethodGet)
+
+			resp := NewMockResponse(t)
+			if tc.WantErrorMatch == nil {
+				resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+					assert.Equal(t, tc.WantStatus, r.StatusCode)
+					body := bytes.NewBuffer(nil)
+					io.Copy(body, r.Body)
+					assert.Equal(t, fmt.Sprintf("attempt %d", tc.WantCalls), body.String())
+					return nil
+				}).Once()
+			}
+
+			ctx := context.Background()
+			if tc.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.Timeout)
+				defer cancel()
+			}
+			if tc.ServerStopped {
+				server.Close()
+			}
+			gotError := client.PerformRequest(ctx, req, resp)
+
+			if tc.WantErrorMatch == nil {
+				assert.NoError(t, gotError)
+			} else if assert.Error(t, gotError) {
+				for _, substr := range tc.WantErrorMatch {
+					assert.Contains(t, gotError.Error(), substr)
+				}
+			}
+			assert.Equal(t, tc.WantCalls, int(calls.Load()))
+		})
+	}
+}
+
+func TestRetryClientOneShotBody(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	native, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client, newError := NewRetryClient(RetryConfig{Backoff: ExponentialBackoff{Base: time.Millisecond}}, native)
+	require.NoError(t, newError)
+
+	req := NewMockRequestWithBody(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodPost)
+	req.EXPECT().Body().Return(strings.NewReader("BODY"))
+
+	resp := NewMockResponse(t)
+	resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+		assert.Equal(t, http.StatusServiceUnavailable, r.StatusCode)
+		return nil
+	}).Once()
+
+	assert.NoError(t, client.PerformRequest(context.Background(), req, resp))
+	assert.Equal(t, 1, int(calls.Load()))
+}
+
+func TestRetryClientContextCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	native, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client, newError := NewRetryClient(RetryConfig{Backoff: ExponentialBackoff{Base: time.Hour}}, native)
+	require.NoError(t, newError)
+
+	req := NewMockRequest(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodGet)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	started := time.Now()
+	gotError := client.PerformRequest(ctx, req, NewMockResponse(t))
+	assert.Error(t, gotError)
+	assert.Less(t, time.Since(started), time.Second)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Base: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+	for attempt, want := range []time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		6: time.Second,
+	} {
+		if attempt == 0 {
+			continue
+		}
+		assert.Equal(t, want, b.Backoff(attempt, 0), "attempt %d", attempt)
+	}
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	b := DecorrelatedJitterBackoff{Base: 10 * time.Millisecond, Max: time.Second}
+	var prev time.Duration
+	for attempt := 1; attempt < 100; attempt++ {
+		upper := 3 * max(prev, b.Base)
+		prev = b.Backoff(attempt, prev)
+		assert.GreaterOrEqual(t, prev, b.Base)
+		assert.LessOrEqual(t, prev, min(upper, b.Max))
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		Value  string
+		Want   time.Duration
+		WantOK bool
+	}{
+		{Value: "", WantOK: false},
+		{Value: "120", Want: 2 * time.Minute, WantOK: true},
+		{Value: "-1", WantOK: false},
+		{Value: "Mon, 01 Apr 2024 12:00:30 GMT", Want: 30 * time.Second, WantOK: true},
+		{Value: "Mon, 01 Apr 2024 11:00:00 GMT", Want: 0, WantOK: true},
+		{Value: "soon", WantOK: false},
+	} {
+		got, ok := parseRetryAfter(tc.Value, now)
+		assert.Equal(t, tc.WantOK, ok, tc.Value)
+		assert.Equal(t, tc.Want, got, tc.Value)
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.False(t, IsTransientError(nil))
+	assert.False(t, IsTransientError(context.Canceled))
+	assert.False(t, IsTransientError(errors.New("WTF")))
+	assert.True(t, IsTransientError(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)))
+	assert.True(t, IsTransientError(io.ErrUnexpectedEOF))
+	assert.True(t, IsTransientError(context.DeadlineExceeded))
+}
+
+func TestRetryClientReplayableBody(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := bytes.NewBuffer(nil)
+		io.Copy(body, r.Body)
+		assert.Equal(t, "BODY", body.String())
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	native, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client, newError := NewRetryClient(RetryConfig{Backoff: ExponentialBackoff{Base: time.Millisecond}}, native)
+	require.NoError(t, newError)
+
+	req := NewMockRequestWithReplayableBody(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodPut)
+	req.EXPECT().ContentLength().Return(4)
+	req.EXPECT().GetBody().RunAndReturn(func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("BODY")), nil
+	})
+
+	resp := NewMockResponse(t)
+	resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+		assert.Equal(t, http.StatusOK, r.StatusCode)
+		return nil
+	}).Once()
+
+	assert.NoError(t, client.PerformRequest(context.Background(), req, resp))
+	assert.Equal(t, 2, int(calls.Load()))
+}
+
+func TestRetryClientNonIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	native, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	post, newError := NewJSONRequest(http.MethodPost, server.URL, "payload")
+	require.NoError(t, newError)
+
+	for _, tc := range []struct {
+		Name      string
+		Config    RetryConfig
+		Request   Request
+		WantCalls int
+	}{
+		{Name: "post", Request: post, WantCalls: 1},
+		{Name: "post marked idempotent", Request: &hedgeTestRequest{JSONRequest: post, options: RequestOptions{Idempotent: true}}, WantCalls: 3},
+		{Name: "retry non idempotent", Config: RetryConfig{RetryNonIdempotent: true}, Request: post, WantCalls: 3},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			calls.Store(0)
+			tc.Config.Backoff = ExponentialBackoff{Base: time.Millisecond}
+			client, newError := NewRetryClient(tc.Config, native)
+			require.NoError(t, newError)
+			resp := &testResponse{}
+			require.NoError(t, client.PerformRequest(context.Background(), tc.Request, resp))
+			assert.Equal(t, http.StatusServiceUnavailable, resp.code)
+			assert.Equal(t, tc.WantCalls, int(calls.Load()))
+		})
+	}
+}
+
+func TestRetryClientProcessResponseError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+	}))
+	defer server.Close()
+	native, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client, newError := NewRetryClient(RetryConfig{Backoff: ExponentialBackoff{Base: time.Millisecond}}, native)
+	require.NoError(t, newError)
+
+	err := client.PerformRequest(context.Background(), testGet(server.URL), &JSONResponse[map[string]int]{})
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 1, int(calls.Load()))
+}
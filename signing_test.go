@@ -0,0 +1,212 @@
+package httpoh
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sigV4TestTime() time.Time {
+	return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+}
+
+// Vectors from the AWS Signature Version 4 test suite and the IAM example of
+// the AWS General Reference.
+func TestAWSSigV4Vectors(t *testing.T) {
+	for _, tc := range []struct {
+		Name          string
+		Method        string
+		URL           string
+		Header        http.Header
+		Service       string
+		WantSigned    string
+		WantSignature string
+	}{
+		{
+			Name:          "get-vanilla",
+			Method:        http.MethodGet,
+			URL:           "https://example.amazonaws.com/",
+			Service:       "service",
+			WantSigned:    "host;x-amz-date",
+			WantSignature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			Name:          "get-vanilla-query-order-key-case",
+			Method:        http.MethodGet,
+			URL:           "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			Service:       "service",
+			WantSigned:    "host;x-amz-date",
+			WantSignature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			Name:          "post-vanilla",
+			Method:        http.MethodPost,
+			URL:           "https://example.amazonaws.com/",
+			Service:       "service",
+			WantSigned:    "host;x-amz-date",
+			WantSignature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			Name:          "iam list users",
+			Method:        http.MethodGet,
+			URL:           "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			Header:        http.Header{"Content-Type": []string{"application/x-www-form-urlencoded; charset=utf-8"}},
+			Service:       "iam",
+			WantSigned:    "content-type;host;x-amz-date",
+			WantSignature: "5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			r, err := http.NewRequest(tc.Method, tc.URL, nil)
+			require.NoError(t, err)
+			for key, values := range tc.Header {
+				r.Header[key] = values
+			}
+			signer := &AWSSigV4{
+				AccessKeyID:     "AKIDEXAMPLE",
+				SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+				Region:          "us-east-1",
+				Service:         tc.Service,
+				Now:             sigV4TestTime,
+			}
+			require.NoError(t, signer.Sign(r))
+
+			assert.Equal(t, "20150830T123600Z", r.Header.Get("X-Amz-Date"))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/"+tc.Service+"/aws4_request, "+
+				"SignedHeaders="+tc.WantSigned+", Signature="+tc.WantSignature, r.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestAWSSigV4SigningKey(t *testing.T) {
+	key := sigV4SigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20150830", "us-east-1", "iam")
+	assert.Equal(t, "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9", hex.EncodeToString(key))
+}
+
+func TestAWSSigV4CanonicalPath(t *testing.T) {
+	for _, tc := range []struct {
+		Path      string
+		Normalize bool
+		Want      string
+	}{
+		{Path: "", Normalize: true, Want: "/"},
+		{Path: "/example/../space dir/", Normalize: true, Want: "/space%2520dir/"},
+		{Path: "/ሴ", Normalize: false, Want: "/%E1%88%B4"},
+		{Path: "/bucket//a b", Normalize: false, Want: "/bucket//a%20b"},
+	} {
+		assert.Equal(t, tc.Want, sigV4CanonicalPath(&url.URL{Path: tc.Path}, tc.Normalize), tc.Path)
+	}
+}
+
+func TestAWSSigV4Middleware(t *testing.T) {
+	var gotAuthorization, gotContentSHA, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuthorization = r.Header.Get("Authorization")
+		gotContentSHA = r.Header.Get("X-Amz-Content-Sha256")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	}))
+	defer server.Close()
+
+	client, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client.Use((&AWSSigV4{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "session",
+		Region:          "us-east-1",
+		Service:         "s3",
+		Now:             sigV4TestTime,
+	}).Wrap)
+
+	req := NewMockRequestWithHeaders(t)
+	req.EXPECT().URL().Return(server.URL + "/bucket/key")
+	req.EXPECT().Method().Return(http.MethodPut)
+	req.EXPECT().Headers().Return(http.Header{"X-Amz-Meta-Owner": []string{"  a   b "}})
+	bodyReq := &testBodyRequest{MockRequestWithHeaders: req, body: "payload"}
+
+	require.NoError(t, client.PerformRequest(context.Background(), bodyReq, &testResponse{}))
+	assert.Equal(t, "payload", gotBody)
+	assert.Equal(t, hexSHA256([]byte("payload")), gotContentSHA)
+	assert.Contains(t, gotAuthorization, "Credential=AKIDEXAMPLE/20150830/us-east-1/s3/aws4_request")
+	assert.Contains(t, gotAuthorization, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-meta-owner;x-amz-security-token,")
+}
+
+type testBodyRequest struct {
+	*MockRequestWithHeaders
+	body string
+}
+
+// Body returns a reader net/http can not replay by itself.
+func (r *testBodyRequest) Body() io.Reader {
+	return io.MultiReader(strings.NewReader(r.body))
+}
+
+func TestHMACSigner(t *testing.T) {
+	secret := []byte("secret")
+	var verified bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodySum := sha256.Sum256(body)
+		stringToSign := strings.Join([]string{
+			r.Method,
+			r.URL.RequestURI(),
+			r.Header.Get("X-Timestamp"),
+			r.Header.Get("Content-Type"),
+			r.Host,
+			hex.EncodeToString(bodySum[:]),
+		}, "\n")
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(stringToSign))
+		verified = r.Header.Get("X-Signature") == base64.StdEncoding.EncodeToString(mac.Sum(nil)) &&
+			r.Header.Get("X-Key-Id") == "key-1" &&
+			r.Header.Get("X-Timestamp") == "1700000000"
+	}))
+	defer server.Close()
+
+	signer := &HMACSigner{
+		KeyID:           "key-1",
+		Secret:          secret,
+		SignedHeaders:   []string{"Content-Type", "Host"},
+		TimestampHeader: "X-Timestamp",
+		Now:             func() time.Time { return time.Unix(1700000000, 0) },
+	}
+	client, newError := NewClientNative(Config{Authenticator: signer}, server.Client())
+	require.NoError(t, newError)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		verified = false
+		var req Request = testGet(server.URL + "/v1/orders?id=1")
+		if method == http.MethodPost {
+			jsonReq, err := NewJSONRequest(method, server.URL+"/v1/orders", map[string]string{"a": "b"})
+			require.NoError(t, err)
+			req = jsonReq
+		}
+		require.NoError(t, client.PerformRequest(context.Background(), req, &testResponse{}))
+		assert.True(t, verified, method)
+	}
+}
+
+func TestHMACSignerHex(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "http://example.com/path?q=1", nil)
+	require.NoError(t, err)
+	signer := &HMACSigner{Secret: []byte("key"), HexSignature: true, SignatureHeader: "Signature"}
+	require.NoError(t, signer.Sign(r))
+
+	mac := hmac.New(sha256.New, []byte("key"))
+	mac.Write([]byte("GET\n/path?q=1\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+	assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), r.Header.Get("Signature"))
+	assert.Empty(t, r.Header.Get("X-Key-Id"))
+}
@@ -0,0 +1,323 @@
+package httpoh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNotEventStream = errors.New("sse: response is not an event stream")
+
+const maxSSELineSize = 1 << 20
+
+// SSEEvent is an event received from a text/event-stream. ID is the last
+// event ID seen on the stream, so it is kept by events without an id field.
+// Type is "message" for events without an event field.
+type SSEEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+type SSEConfig struct {
+	RetryDelay time.Duration
+	MaxRetries int
+}
+
+// SSEClient subscribes to Server-Sent Events endpoints with Client. A stream
+// ending or failing with a network error, a 429 or a 5xx status is
+// reconnected after RetryDelay (3s by default) or the delay set by the
+// server with a retry field, sending the last event ID in the Last-Event-ID
+// header. MaxRetries limits reconnections in a row without receiving an
+// event, 0 means no limit. Other statuses, content types and errors end the
+// subscription, 204 No Content without error.
+type SSEClient struct {
+	Client     *ClientNative
+	RetryDelay time.Duration
+	MaxRetries int
+}
+
+func NewSSEClient(cfg SSEConfig, client *ClientNative) (*SSEClient, error) {
+	if client == nil {
+		return nil, errors.New("sse client: client is nil")
+	}
+	if cfg.RetryDelay < 0 || cfg.MaxRetries < 0 {
+		return nil, fmt.Errorf("sse client: invalid retry delay %v or max retries %d", cfg.RetryDelay, cfg.MaxRetries)
+	}
+	c := &SSEClient{
+		Client:     client,
+		RetryDelay: cfg.RetryDelay,
+		MaxRetries: cfg.MaxRetries,
+	}
+	if c.RetryDelay == 0 {
+		c.RetryDelay = 3 * time.Second
+	}
+	return c, nil
+}
+
+// SSEStream delivers the events of a subscription on Events, which is closed
+// when the subscription ends.
+type SSEStream struct {
+	Events <-chan SSEEvent
+	done   chan struct{}
+	err    error
+}
+
+// Err waits for the subscription to end and returns the reason, nil when it
+// was stopped by the context or the server replied 204 No Content.
+func (s *SSEStream) Err() error {
+	<-s.done
+	return s.err
+}
+
+// Subscribe sends req and keeps delivering its events until ctx is done. The
+// body of req is resent on reconnection, so it must be replayable.
+func (c *SSEClient) Subscribe(ctx context.Context, req Request) *SSEStream {
+	events := make(chan SSEEvent)
+	s := &SSEStream{Events: events, done: make(chan struct{})}
+	sub := &sseSubscription{
+		client: c,
+		req:    req,
+		events: events,
+		caller: callerLine(2),
+		retry:  c.RetryDelay,
+	}
+	if hReq, implements := req.(RequestWithHeaders); implements {
+		sub.lastID = hReq.Headers().Get("Last-Event-ID")
+	}
+	go func() {
+		defer close(s.done)
+		defer close(events)
+		s.err = sub.run(ctx)
+	}()
+	return s
+}
+
+type sseSubscription struct {
+	client *SSEClient
+	req    Request
+	events chan<- SSEEvent
+	caller string
+	lastID string
+	retry  time.Duration
+}
+
+func (s *sseSubscription) run(ctx context.Context) error {
+	if !canResend(s.req) {
+		return errors.New("sse: request body can not be resent on reconnection")
+	}
+	retries := 0
+	for {
+		received, err := s.connect(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var statusErr *StatusError
+		switch {
+		case errors.As(err, &statusErr):
+			if statusErr.StatusCode == http.StatusNoContent {
+				return nil
+			}
+			if statusErr.StatusCode != http.StatusTooManyRequests && statusErr.StatusCode < 500 {
+				return err
+			}
+		case !IsTransientError(err):
+			// io.EOF of a stream ending is transient too
+			return err
+		}
+
+		if received {
+			retries = 0
+		}
+		retries++
+		if s.client.MaxRetries > 0 && retries > s.client.MaxRetries {
+			return fmt.Errorf("sse: giving up after %d retries: %w", s.client.MaxRetries, err)
+		}
+		if sleepContext(ctx, s.retry) != nil {
+			return nil
+		}
+	}
+}
+
+// connect reads events until the stream ends, returning io.EOF when it ends
+// without error. received reports whether any event was delivered.
+func (s *sseSubscription) connect(ctx context.Context) (received bool, err error) {
+	stream, err := s.client.Client.stream(ctx, newSSERequest(s.req, s.lastID), s.caller)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(stream.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		return false, fmt.Errorf("%w: content type %q", ErrNotEventStream, stream.Header.Get("Content-Type"))
+	}
+
+	err = s.readEvents(stream, func(event SSEEvent) bool {
+		select {
+		case s.events <- event:
+			received = true
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	if err == nil {
+		err = io.EOF
+	}
+	return received, err
+}
+
+// readEvents parses the event stream r, passing events to emit until it
+// returns false.
+func (s *sseSubscription) readEvents(r io.Reader, emit func(SSEEvent) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxSSELineSize)
+	scanner.Split(scanSSELines())
+
+	var data strings.Builder
+	hasData, eventType, first := false, "", true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+		if line == "" {
+			if hasData {
+				event := SSEEvent{ID: s.lastID, Type: eventType, Data: data.String()}
+				if event.Type == "" {
+					event.Type = "message"
+				}
+				if !emit(event) {
+					return nil
+				}
+			}
+			data.Reset()
+			hasData, eventType = false, ""
+			continue
+		}
+
+		field, value, found := strings.Cut(line, ":")
+		if found {
+			value = strings.TrimPrefix(value, " ")
+		}
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastID = value
+			}
+		case "retry":
+			if value != "" && strings.Trim(value, "0123456789") == "" {
+				if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+					s.retry = time.Duration(ms) * time.Millisecond
+				}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// scanSSELines splits lines ended by CRLF, LF or CR. A line not ended when
+// the stream ends is dropped.
+func scanSSELines() bufio.SplitFunc {
+	afterCR := false
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		// the LF of a CRLF is skipped along with the next line, as the
+		// scanner stops at EOF after a call returning no token
+		skip := 0
+		if afterCR && len(data) > 0 && data[0] == '\n' {
+			skip = 1
+		}
+		if i := bytes.IndexAny(data[skip:], "\r\n"); i >= 0 {
+			afterCR = data[skip+i] == '\r'
+			return skip + i + 1, data[skip : skip+i], nil
+		}
+		if len(data) > 0 {
+			afterCR = false
+		}
+		return skip, nil, nil
+	}
+}
+
+// sseRequest adds the event stream headers to the request of a subscription.
+type sseRequest struct {
+	Request
+	lastID string
+}
+
+func newSSERequest(req Request, lastID string) Request {
+	r := &sseRequest{Request: req, lastID: lastID}
+	if _, implements := req.(RequestWithURLTemplate); implements {
+		return &sseTemplateRequest{r}
+	}
+	return r
+}
+
+func (r *sseRequest) Headers() http.Header {
+	var header http.Header
+	if hReq, implements := r.Request.(RequestWithHeaders); implements {
+		header = hReq.Headers().Clone()
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Accept") == "" {
+		header.Set("Accept", "text/event-stream")
+	}
+	header.Set("Cache-Control", "no-cache")
+	if r.lastID != "" {
+		header.Set("Last-Event-ID", r.lastID)
+	} else {
+		header.Del("Last-Event-ID")
+	}
+	return header
+}
+
+func (r *sseRequest) Options() RequestOptions {
+	return requestOptions(r.Request)
+}
+
+func (r *sseRequest) GetBody() (io.ReadCloser, error) {
+	if rReq, implements := r.Request.(RequestWithReplayableBody); implements {
+		return rReq.GetBody()
+	}
+	return http.NoBody, nil
+}
+
+func (r *sseRequest) ContentLength() int64 {
+	if rReq, implements := r.Request.(RequestWithReplayableBody); implements {
+		return rReq.ContentLength()
+	}
+	return 0
+}
+
+// AcceptStatus makes any status but 200 OK an error, including redirects
+// not followed.
+func (r *sseRequest) AcceptStatus(statusCode int) bool {
+	return statusCode == http.StatusOK
+}
+
+type sseTemplateRequest struct {
+	*sseRequest
+}
+
+func (r *sseTemplateRequest) URLTemplate() string {
+	return r.Request.(RequestWithURLTemplate).URLTemplate()
+}
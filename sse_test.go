@@ -0,0 +1,180 @@
+package httpoh
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSEReadEvents(t *testing.T) {
+	for _, tc := range []struct {
+		Name       string
+		Stream     string
+		WantEvents []SSEEvent
+		WantLastID string
+		WantRetry  time.Duration
+	}{
+		{
+			Name:       "fields",
+			Stream:     "id: 1\nevent: update\ndata: first\ndata:  second\n\n: comment\ndata\n\n",
+			WantEvents: []SSEEvent{{ID: "1", Type: "update", Data: "first\n second"}, {ID: "1", Type: "message", Data: ""}},
+			WantLastID: "1",
+		},
+		{
+			Name:       "line endings",
+			Stream:     "\ufeffdata:a\r\n\r\ndata:b\r\rdata:c\n\n",
+			WantEvents: []SSEEvent{{Type: "message", Data: "a"}, {Type: "message", Data: "b"}, {Type: "message", Data: "c"}},
+		},
+		{
+			Name:       "id without data",
+			Stream:     "id: 7\n\nevent: ignored\n\ndata: x\n\n",
+			WantEvents: []SSEEvent{{ID: "7", Type: "message", Data: "x"}},
+			WantLastID: "7",
+		},
+		{
+			Name:       "invalid id and retry",
+			Stream:     "id: 1\nid: a\x00b\nretry: 1s\nretry: 250\nretry: -5\ndata: x\n\n",
+			WantEvents: []SSEEvent{{ID: "1", Type: "message", Data: "x"}},
+			WantLastID: "1",
+			WantRetry:  250 * time.Millisecond,
+		},
+		{
+			Name:       "unterminated event dropped",
+			Stream:     "data: done\n\ndata: partial\nid: 9",
+			WantEvents: []SSEEvent{{Type: "message", Data: "done"}},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			sub := &sseSubscription{}
+			var events []SSEEvent
+			err := sub.readEvents(strings.NewReader(tc.Stream), func(event SSEEvent) bool {
+				events = append(events, event)
+				return true
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.WantEvents, events)
+			assert.Equal(t, tc.WantLastID, sub.lastID)
+			assert.Equal(t, tc.WantRetry, sub.retry)
+		})
+	}
+}
+
+func newSSETestClient(t *testing.T, cfg SSEConfig) *SSEClient {
+	client := newStreamTestClient(t)
+	sse, err := NewSSEClient(cfg, client)
+	require.NoError(t, err)
+	return sse
+}
+
+func TestSSEReconnect(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		switch connections.Add(1) {
+		case 1:
+			assert.Equal(t, "0", r.Header.Get("Last-Event-ID"))
+			io.WriteString(w, "retry: 10\nid: 1\ndata: one\n\n")
+		case 2:
+			assert.Equal(t, "1", r.Header.Get("Last-Event-ID"))
+			io.WriteString(w, "id: 2\nevent: tick\ndata: two\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+	client := newSSETestClient(t, SSEConfig{RetryDelay: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := NewMockRequestWithHeaders(t)
+	req.EXPECT().Method().Return(http.MethodGet)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Headers().Return(http.Header{"Last-Event-ID": {"0"}})
+	stream := client.Subscribe(ctx, req)
+	assert.Equal(t, SSEEvent{ID: "1", Type: "message", Data: "one"}, <-stream.Events)
+	assert.Equal(t, SSEEvent{ID: "2", Type: "tick", Data: "two"}, <-stream.Events)
+	cancel()
+
+	_, open := <-stream.Events
+	assert.False(t, open)
+	assert.NoError(t, stream.Err())
+	assert.Equal(t, int32(2), connections.Load())
+}
+
+func TestSSEStop(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connections.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch r.URL.Path {
+		case "/done":
+			w.WriteHeader(http.StatusNoContent)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "<html>")
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/closing":
+			io.WriteString(w, "retry: 1\n")
+		}
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		Path            string
+		WantErr         string
+		WantConnections int32
+	}{
+		{Path: "/done", WantConnections: 1},
+		{Path: "/missing", WantErr: "404", WantConnections: 1},
+		{Path: "/html", WantErr: `response is not an event stream: content type "text/html"`, WantConnections: 1},
+		{Path: "/unavailable", WantErr: "giving up after 2 retries", WantConnections: 3},
+		{Path: "/closing", WantErr: "giving up after 2 retries: EOF", WantConnections: 3},
+	} {
+		t.Run(tc.Path, func(t *testing.T) {
+			connections.Store(0)
+			client := newSSETestClient(t, SSEConfig{RetryDelay: time.Millisecond, MaxRetries: 2})
+
+			stream := client.Subscribe(context.Background(), testGet(server.URL+tc.Path))
+			for range stream.Events {
+				t.Error("unexpected event")
+			}
+			if tc.WantErr == "" {
+				assert.NoError(t, stream.Err())
+			} else {
+				assert.ErrorContains(t, stream.Err(), tc.WantErr)
+			}
+			assert.Equal(t, tc.WantConnections, connections.Load())
+		})
+	}
+}
+
+func TestSSEOneShotBody(t *testing.T) {
+	client := newSSETestClient(t, SSEConfig{})
+	req := &redirectTestRequest{method: http.MethodPost, url: "http://api.test/", body: "payload"}
+	stream := client.Subscribe(context.Background(), req)
+	assert.ErrorContains(t, stream.Err(), "request body can not be resent")
+}
+
+func TestSSERequestError(t *testing.T) {
+	client := newSSETestClient(t, SSEConfig{RetryDelay: time.Millisecond})
+	stream := client.Subscribe(context.Background(), testGet("http://api.test/%zz"))
+	assert.ErrorContains(t, stream.Err(), "invalid URL escape")
+}
+
+func TestNewSSEClientErrors(t *testing.T) {
+	_, err := NewSSEClient(SSEConfig{}, nil)
+	assert.ErrorContains(t, err, "client is nil")
+	_, err = NewSSEClient(SSEConfig{MaxRetries: -1}, &ClientNative{})
+	assert.ErrorContains(t, err, "invalid retry delay 0s or max retries -1")
+}
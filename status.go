@@ -0,0 +1,80 @@
+package httpoh
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const defaultStatusErrorBodyLimit = 512
+
+// StatusError is returned by PerformRequest for responses with a status not
+// accepted by the status policy. Body holds the beginning of the response body.
+type StatusError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: unexpected response status %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func newStatusError(r *http.Response, bodyLimit int) *StatusError {
+	e := &StatusError{
+		StatusCode: r.StatusCode,
+		Header:     r.Header,
+	}
+	if r.Request != nil {
+		e.Method = r.Request.Method
+		e.URL = r.Request.URL.String()
+	}
+	if bodyLimit == 0 {
+		bodyLimit = defaultStatusErrorBodyLimit
+	}
+	if bodyLimit > 0 {
+		e.Body, _ = io.ReadAll(io.LimitReader(r.Body, int64(bodyLimit)))
+	}
+	return e
+}
+
+// StatusChecker decides which response statuses are acceptable. It may be
+// implemented by a Request to enable status checking for that request, or by
+// a Response to handle non-2xx statuses itself. The Response decision wins.
+// Without a StatusChecker, Config.CheckStatus makes every non-2xx status an error.
+type StatusChecker interface {
+	AcceptStatus(statusCode int) bool
+}
+
+func (c *ClientNative) acceptStatus(req Request, resp Response, statusCode int) bool {
+	if checker, ok := findResponse[StatusChecker](resp); ok {
+		return checker.AcceptStatus(statusCode)
+	}
+	if checker, ok := req.(StatusChecker); ok {
+		return checker.AcceptStatus(statusCode)
+	}
+	return !c.CheckStatus || isSuccessStatus(statusCode)
+}
+
+func isSuccessStatus(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
+
+// findResponse looks for a Response implementing T, following Unwrap through
+// Response wrappers installed by client decorators.
+func findResponse[T any](resp Response) (T, bool) {
+	for resp != nil {
+		if found, ok := resp.(T); ok {
+			return found, true
+		}
+		wrapper, ok := resp.(interface{ Unwrap() Response })
+		if !ok {
+			break
+		}
+		resp = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
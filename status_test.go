@@ -0,0 +1,174 @@
+package httpoh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type testStatusCheckingRequest struct {
+	testRequest
+	accept func(int) bool
+}
+
+func (r testStatusCheckingRequest) AcceptStatus(code int) bool { return r.accept(code) }
+
+type testStatusCheckingResponse struct {
+	testResponse
+	accept func(int) bool
+}
+
+func (r *testStatusCheckingResponse) AcceptStatus(code int) bool { return r.accept(code) }
+
+func TestStatusError(t *testing.T) {
+	acceptAll := func(int) bool { return true }
+	accept404 := func(code int) bool { return code == http.StatusNotFound }
+	for _, tc := range []struct {
+		Name           string
+		Config         Config
+		ServerStatus   int
+		ServerBody     string
+		RequestAccept  func(int) bool
+		ResponseAccept func(int) bool
+		WantProcessed  bool
+		WantStatusErr  bool
+		WantBody       string
+	}{
+		{
+			Name:          "status not checked by default",
+			ServerStatus:  http.StatusInternalServerError,
+			WantProcessed: true,
+		},
+		{
+			Name:          "success status",
+			Config:        Config{CheckStatus: true},
+			ServerStatus:  http.StatusNoContent,
+			WantProcessed: true,
+		},
+		{
+			Name:          "error status",
+			Config:        Config{CheckStatus: true},
+			ServerStatus:  http.StatusInternalServerError,
+			ServerBody:    "internal error",
+			WantStatusErr: true,
+			WantBody:      "internal error",
+		},
+		{
+			Name:          "body snippet bounded",
+			Config:        Config{CheckStatus: true, StatusErrorBodyLimit: 4},
+			ServerStatus:  http.StatusBadRequest,
+			ServerBody:    "bad request",
+			WantStatusErr: true,
+			WantBody:      "bad ",
+		},
+		{
+			Name:          "body snippet disabled",
+			Config:        Config{CheckStatus: true, StatusErrorBodyLimit: -1},
+			ServerStatus:  http.StatusBadRequest,
+			ServerBody:    "bad request",
+			WantStatusErr: true,
+		},
+		{
+			Name:          "request enables check",
+			ServerStatus:  http.StatusInternalServerError,
+			RequestAccept: isSuccessStatus,
+			WantStatusErr: true,
+		},
+		{
+			Name:          "request accepts 404",
+			Config:        Config{CheckStatus: true},
+			ServerStatus:  http.StatusNotFound,
+			RequestAccept: accept404,
+			WantProcessed: true,
+		},
+		{
+			Name:           "response opts out",
+			Config:         Config{CheckStatus: true},
+			ServerStatus:   http.StatusInternalServerError,
+			RequestAccept:  isSuccessStatus,
+			ResponseAccept: acceptAll,
+			WantProcessed:  true,
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Test", "yes")
+				w.WriteHeader(tc.ServerStatus)
+				w.Write([]byte(tc.ServerBody))
+			}))
+			defer server.Close()
+
+			client, newError := NewClientNative(tc.Config, server.Client())
+			require.NoError(t, newError)
+
+			var req Request = testRequest{method: http.MethodPut, url: server.URL + "/path"}
+			if tc.RequestAccept != nil {
+				req = testStatusCheckingRequest{testRequest: req.(testRequest), accept: tc.RequestAccept}
+			}
+
+			var resp Response
+			var processed *testResponse
+			if tc.ResponseAccept != nil {
+				checking := &testStatusCheckingResponse{accept: tc.ResponseAccept}
+				resp, processed = checking, &checking.testResponse
+			} else {
+				processed = &testResponse{}
+				resp = processed
+			}
+
+			gotError := client.PerformRequest(context.Background(), req, resp)
+			if tc.WantProcessed {
+				assert.NoError(t, gotError)
+				assert.Equal(t, tc.ServerStatus, processed.code)
+			} else {
+				assert.Zero(t, processed.code)
+			}
+
+			var statusErr *StatusError
+			if tc.WantStatusErr && assert.True(t, errors.As(gotError, &statusErr)) {
+				assert.Equal(t, tc.ServerStatus, statusErr.StatusCode)
+				assert.Equal(t, http.MethodPut, statusErr.Method)
+				assert.Equal(t, server.URL+"/path", statusErr.URL)
+				assert.Equal(t, "yes", statusErr.Header.Get("X-Test"))
+				assert.Equal(t, tc.WantBody, string(statusErr.Body))
+				assert.True(t, strings.HasSuffix(statusErr.Error(), http.StatusText(tc.ServerStatus)))
+			}
+		})
+	}
+}
+
+func TestStatusErrorRetried(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	native, newError := NewClientNative(Config{CheckStatus: true}, server.Client())
+	require.NoError(t, newError)
+	client, newError := NewRetryClient(RetryConfig{MaxAttempts: 2}, native)
+	require.NoError(t, newError)
+
+	req := NewMockRequest(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodGet)
+
+	resp := NewMockResponse(t)
+	resp.EXPECT().ProcessResponse(mock.Anything).Return(nil).Once()
+
+	assert.NoError(t, client.PerformRequest(context.Background(), req, resp))
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,179 @@
+package httpoh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// StreamingResponse is a response whose body is owned by the caller. It reads
+// the body, and must be closed once the caller is done with it, even without
+// reading anything. Closing the body field has the same effect.
+type StreamingResponse struct {
+	*http.Response
+}
+
+var _ io.ReadCloser = (*StreamingResponse)(nil)
+
+func (s *StreamingResponse) Read(p []byte) (int, error) {
+	return s.Body.Read(p)
+}
+
+func (s *StreamingResponse) Close() error {
+	return s.Body.Close()
+}
+
+// Stream sends req like PerformRequest and returns as soon as the response
+// headers are received, leaving the body to be read at the caller's pace,
+// possibly from another goroutine. Statuses are checked as by PerformRequest,
+// with req as the only StatusChecker, and a rejected response is returned as
+// a *StatusError. ctx and the timeouts of RequestOptions apply until the
+// response is closed, and tracing and metrics see the request end then.
+func (c *ClientNative) Stream(ctx context.Context, req Request) (*StreamingResponse, error) {
+	return c.stream(ctx, req, callerLine(2))
+}
+
+func (c *ClientNative) stream(ctx context.Context, req Request, caller string) (*StreamingResponse, error) {
+	x, err := c.send(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !c.acceptStatus(req, nil, x.netResp.StatusCode) {
+		return nil, x.finish(newStatusError(x.netResp, c.StatusErrorBodyLimit))
+	}
+
+	body := &streamBody{exchange: x, tracker: c.Streams}
+	c.Streams.add(body, OpenStream{Method: req.Method(), URL: req.URL(), Caller: caller})
+	x.netResp.Body = body
+	return &StreamingResponse{Response: x.netResp}, nil
+}
+
+// streamBody releases the exchange when the caller closes it.
+type streamBody struct {
+	exchange *exchange
+	tracker  *StreamTracker
+
+	mu       sync.Mutex
+	readErr  error
+	closed   bool
+	closeErr error
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.exchange.body.Read(p)
+	if err != nil && err != io.EOF {
+		err = withTimeoutCause(b.exchange.ctx, err)
+		b.mu.Lock()
+		if b.readErr == nil {
+			b.readErr = err
+		}
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return b.closeErr
+	}
+	b.closed = true
+	b.closeErr = b.exchange.body.Close()
+	b.exchange.release(b.readErr)
+	b.tracker.remove(b)
+	return b.closeErr
+}
+
+// OpenStream describes a stream not closed yet. Caller is the file and line
+// Stream was called from.
+type OpenStream struct {
+	Method string
+	URL    string
+	Caller string
+}
+
+// StreamTracker records the streams of a ClientNative, set as its Streams
+// field, until they are closed. It is meant for tests looking for leaked
+// response bodies. A nil StreamTracker records nothing.
+type StreamTracker struct {
+	mu   sync.Mutex
+	seq  int
+	open map[*streamBody]trackedStream
+}
+
+type trackedStream struct {
+	seq int
+	OpenStream
+}
+
+func NewStreamTracker() *StreamTracker {
+	return &StreamTracker{open: make(map[*streamBody]trackedStream)}
+}
+
+func (t *StreamTracker) add(body *streamBody, stream OpenStream) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	t.open[body] = trackedStream{seq: t.seq, OpenStream: stream}
+}
+
+func (t *StreamTracker) remove(body *streamBody) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.open, body)
+}
+
+// Open returns the streams not closed yet, in the order they were opened.
+func (t *StreamTracker) Open() []OpenStream {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	tracked := make([]trackedStream, 0, len(t.open))
+	for _, stream := range t.open {
+		tracked = append(tracked, stream)
+	}
+	t.mu.Unlock()
+
+	slices.SortFunc(tracked, func(a, b trackedStream) int { return a.seq - b.seq })
+	streams := make([]OpenStream, len(tracked))
+	for i, stream := range tracked {
+		streams[i] = stream.OpenStream
+	}
+	return streams
+}
+
+// Check returns an error listing the streams not closed yet, if any. Tests
+// typically call it from t.Cleanup.
+func (t *StreamTracker) Check() error {
+	streams := t.Open()
+	if len(streams) == 0 {
+		return nil
+	}
+	lines := make([]string, len(streams))
+	for i, stream := range streams {
+		lines[i] = fmt.Sprintf("%s %s opened at %s", stream.Method, stream.URL, stream.Caller)
+	}
+	return fmt.Errorf("%d response streams not closed:\n%s", len(streams), strings.Join(lines, "\n"))
+}
+
+// callerLine returns the file and line of the caller skip frames up.
+func callerLine(skip int) string {
+	_, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
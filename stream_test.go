@@ -0,0 +1,155 @@
+package httpoh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type finishedMetrics struct {
+	finished chan RequestMetrics
+}
+
+func (m *finishedMetrics) RequestStarted(method, host string) {}
+
+func (m *finishedMetrics) RequestFinished(measure RequestMetrics) {
+	m.finished <- measure
+}
+
+func newStreamTestClient(t *testing.T) *ClientNative {
+	client, err := NewClientNative(Config{CheckStatus: true}, http.DefaultClient)
+	require.NoError(t, err)
+	client.Streams = NewStreamTracker()
+	t.Cleanup(func() { assert.NoError(t, client.Streams.Check()) })
+	return client
+}
+
+func TestStreamReadAfterReturn(t *testing.T) {
+	next := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Stream", "yes")
+		io.WriteString(w, "first;")
+		w.(http.Flusher).Flush()
+		<-next
+		io.WriteString(w, "second")
+	}))
+	defer server.Close()
+	client := newStreamTestClient(t)
+	metrics := &finishedMetrics{finished: make(chan RequestMetrics, 1)}
+	client.Metrics = metrics
+
+	stream, err := client.Stream(context.Background(), testGet(server.URL))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, stream.StatusCode)
+	assert.Equal(t, "yes", stream.Header.Get("X-Stream"))
+
+	body := make(chan string)
+	go func() {
+		defer stream.Close()
+		data, err := io.ReadAll(stream)
+		assert.NoError(t, err)
+		body <- string(data)
+	}()
+	assert.Empty(t, metrics.finished)
+	close(next)
+	assert.Equal(t, "first;second", <-body)
+
+	measure := <-metrics.finished
+	assert.Equal(t, int64(len("first;second")), measure.ResponseSize)
+	assert.NoError(t, measure.Err)
+	assert.NoError(t, stream.Close())
+}
+
+func TestStreamLeakDetection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "body")
+	}))
+	defer server.Close()
+	client, err := NewClientNative(Config{}, http.DefaultClient)
+	require.NoError(t, err)
+	client.Streams = NewStreamTracker()
+
+	first, err := client.Stream(context.Background(), testGet(server.URL+"/first"))
+	require.NoError(t, err)
+	second, err := client.Stream(context.Background(), testGet(server.URL+"/second"))
+	require.NoError(t, err)
+
+	require.NoError(t, first.Body.Close())
+	err = client.Streams.Check()
+	assert.ErrorContains(t, err, fmt.Sprintf("1 response streams not closed:\nGET %s/second opened at ", server.URL))
+	assert.ErrorContains(t, err, "stream_test.go:")
+
+	require.NoError(t, second.Close())
+	assert.NoError(t, client.Streams.Check())
+	assert.Empty(t, client.Streams.Open())
+
+	var tracker *StreamTracker
+	assert.Empty(t, tracker.Open())
+	assert.NoError(t, tracker.Check())
+}
+
+func TestStreamErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "try later")
+		case "/stall":
+			io.WriteString(w, "first")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}))
+	defer server.Close()
+
+	t.Run("rejected status", func(t *testing.T) {
+		client := newStreamTestClient(t)
+		_, err := client.Stream(context.Background(), testGet(server.URL+"/unavailable"))
+		var statusErr *StatusError
+		require.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+		assert.Equal(t, "try later", string(statusErr.Body))
+	})
+
+	t.Run("idle read timeout", func(t *testing.T) {
+		client := newStreamTestClient(t)
+		req := NewMockRequestWithOptions(t)
+		req.EXPECT().URL().Return(server.URL + "/stall")
+		req.EXPECT().Method().Return(http.MethodGet)
+		req.EXPECT().Options().Return(RequestOptions{IdleReadTimeout: 20 * time.Millisecond})
+
+		stream, err := client.Stream(context.Background(), req)
+		require.NoError(t, err)
+		defer stream.Close()
+		body, err := io.ReadAll(stream)
+		assert.Equal(t, "first", string(body))
+		assert.ErrorIs(t, err, ErrIdleReadTimeout)
+	})
+
+	t.Run("context cancelled while reading", func(t *testing.T) {
+		client := newStreamTestClient(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := client.Stream(ctx, testGet(server.URL+"/stall"))
+		require.NoError(t, err)
+		defer stream.Close()
+		time.AfterFunc(20*time.Millisecond, cancel)
+		_, err = io.ReadAll(stream)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("connection refused", func(t *testing.T) {
+		client := newStreamTestClient(t)
+		_, err := client.Stream(context.Background(), testGet("http://127.0.0.1:1/"))
+		assert.Error(t, err)
+	})
+}
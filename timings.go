@@ -0,0 +1,98 @@
+package httpoh
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings is the breakdown of a request duration. For redirected requests
+// DNS, Connect and TLSHandshake are summed over all hops while
+// TimeToFirstByte and ConnectionReused describe the last one.
+// TimeToFirstByte runs from getting the connection, when the request starts
+// to be written, to the first byte of the response.
+type Timings struct {
+	DNS              time.Duration
+	Connect          time.Duration
+	TLSHandshake     time.Duration
+	TimeToFirstByte  time.Duration
+	Total            time.Duration
+	ConnectionReused bool
+}
+
+type timingsRecorder struct {
+	mu           sync.Mutex
+	start        time.Time
+	hopStart     time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timings      Timings
+}
+
+func withTimingsTrace(ctx context.Context) (context.Context, *timingsRecorder) {
+	r := &timingsRecorder{start: time.Now()}
+	return httptrace.WithClientTrace(ctx, r.clientTrace()), r
+}
+
+func (r *timingsRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timings.DNS += time.Since(r.dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			// parallel dials of several addresses count once
+			if r.connectStart.IsZero() {
+				r.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err == nil && !r.connectStart.IsZero() {
+				r.timings.Connect += time.Since(r.connectStart)
+				r.connectStart = time.Time{}
+			}
+		},
+		TLSHandshakeStart: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timings.TLSHandshake += time.Since(r.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timings.ConnectionReused = info.Reused
+			r.hopStart = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timings.TimeToFirstByte = time.Since(r.hopStart)
+		},
+	}
+}
+
+func (r *timingsRecorder) result() Timings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.timings
+	t.Total = time.Since(r.start)
+	return t
+}
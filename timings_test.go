@@ -0,0 +1,118 @@
+package httpoh
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseWithTimings(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	httpClient := server.Client()
+	transport := httpClient.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.ServerName = "example.com"
+	httpClient.Transport = transport
+
+	client, newError := NewClientNative(Config{}, httpClient)
+	require.NoError(t, newError)
+
+	var got []Timings
+	for i := 0; i < 2; i++ {
+		req := NewMockRequest(t)
+		req.EXPECT().URL().Return(url)
+		req.EXPECT().Method().Return(http.MethodGet)
+
+		resp := NewMockResponseWithTimings(t)
+		resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+			_, err := io.Copy(io.Discard, r.Body)
+			return err
+		}).Once()
+		resp.EXPECT().SetTimings(mock.Anything).Run(func(timings Timings) {
+			got = append(got, timings)
+		}).Once()
+
+		require.NoError(t, client.PerformRequest(context.Background(), req, resp))
+	}
+	require.Len(t, got, 2)
+
+	first := got[0]
+	assert.False(t, first.ConnectionReused)
+	assert.Positive(t, first.DNS)
+	assert.Positive(t, first.Connect)
+	assert.Positive(t, first.TLSHandshake)
+	assert.Positive(t, first.TimeToFirstByte)
+	// connection setup is not part of the time to first byte
+	assert.LessOrEqual(t, first.TimeToFirstByte, first.Total-first.DNS-first.Connect-first.TLSHandshake)
+
+	second := got[1]
+	assert.True(t, second.ConnectionReused)
+	assert.Zero(t, second.DNS)
+	assert.Zero(t, second.Connect)
+	assert.Zero(t, second.TLSHandshake)
+	assert.Positive(t, second.TimeToFirstByte)
+	assert.LessOrEqual(t, second.TimeToFirstByte, second.Total)
+}
+
+func TestResponseWithTimingsOnError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	client, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+
+	req := NewMockRequest(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodGet)
+
+	resp := NewMockResponseWithTimings(t)
+	var got Timings
+	resp.EXPECT().SetTimings(mock.Anything).Run(func(timings Timings) { got = timings }).Once()
+
+	assert.Error(t, client.PerformRequest(context.Background(), req, resp))
+	assert.Zero(t, got.TimeToFirstByte)
+	assert.Positive(t, got.Total)
+}
+
+func TestTimingsThroughRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	native, newError := NewClientNative(Config{}, server.Client())
+	require.NoError(t, newError)
+	client, newError := NewRetryClient(RetryConfig{Backoff: ExponentialBackoff{Base: time.Millisecond}}, native)
+	require.NoError(t, newError)
+
+	req := NewMockRequest(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodGet)
+
+	resp := NewMockResponseWithTimings(t)
+	resp.EXPECT().ProcessResponse(mock.Anything).Return(nil).Once()
+	var got []Timings
+	resp.EXPECT().SetTimings(mock.Anything).Run(func(timings Timings) { got = append(got, timings) }).Times(2)
+
+	require.NoError(t, client.PerformRequest(context.Background(), req, resp))
+	require.Len(t, got, 2)
+	assert.True(t, got[1].ConnectionReused)
+}
@@ -0,0 +1,208 @@
+package httpoh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrCertificatePinMismatch = errors.New("tls: no certificate matches pinned public keys")
+
+// TLSConfig holds TLS settings of the client built by NewNetHTTPClient.
+//
+// The client certificate comes either from CertFile and KeyFile, reloaded
+// when the files change on disk (checked at most once per ReloadInterval,
+// on every handshake by default), or from CertPEM and KeyPEM. RootCAFiles and
+// RootCAPEM replace the system roots unless AppendSystemRoots is set.
+// PinnedSPKI holds base64 SHA-256 hashes of subject public key infos: when
+// set, one of the certificates of the verified chain must match one of them,
+// or the leaf certificate when verification is skipped.
+type TLSConfig struct {
+	CertFile          string
+	KeyFile           string
+	CertPEM           []byte
+	KeyPEM            []byte
+	ReloadInterval    time.Duration
+	RootCAFiles       []string
+	RootCAPEM         []byte
+	AppendSystemRoots bool
+	ServerName        string
+	MinVersion        uint16
+	MaxVersion        uint16
+	CipherSuites      []uint16
+	PinnedSPKI        []string
+}
+
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	c := cfg.TLS
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		MaxVersion:         c.MaxVersion,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         c.ServerName,
+		CipherSuites:       c.CipherSuites,
+	}
+	if c.MinVersion != 0 {
+		tlsConfig.MinVersion = c.MinVersion
+	}
+	if c.MaxVersion != 0 && c.MaxVersion < tlsConfig.MinVersion {
+		return nil, fmt.Errorf("tls config: max version %#04x is below min version %#04x", c.MaxVersion, tlsConfig.MinVersion)
+	}
+
+	switch {
+	case c.CertFile != "" || c.KeyFile != "":
+		if c.CertFile == "" || c.KeyFile == "" || c.CertPEM != nil || c.KeyPEM != nil {
+			return nil, errors.New("tls config: client certificate needs both CertFile and KeyFile, and no PEM")
+		}
+		reloader, err := newCertReloader(c.CertFile, c.KeyFile, c.ReloadInterval)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = reloader.getClientCertificate
+	case c.CertPEM != nil || c.KeyPEM != nil:
+		cert, err := tls.X509KeyPair(c.CertPEM, c.KeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("tls config: client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.RootCAFiles) > 0 || len(c.RootCAPEM) > 0 {
+		pool, err := rootCAPool(c)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(c.PinnedSPKI) > 0 {
+		pins := make(map[[sha256.Size]byte]bool, len(c.PinnedSPKI))
+		for _, pin := range c.PinnedSPKI {
+			sum, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("tls config: invalid SPKI pin %q", pin)
+			}
+			pins[[sha256.Size]byte(sum)] = true
+		}
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(cs, pins)
+		}
+	}
+	return tlsConfig, nil
+}
+
+func rootCAPool(c TLSConfig) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if c.AppendSystemRoots {
+		systemPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("tls config: system roots: %w", err)
+		}
+		pool = systemPool
+	}
+	for _, file := range c.RootCAFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("tls config: root CA: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("tls config: no certificates in root CA file %s", file)
+		}
+	}
+	if len(c.RootCAPEM) > 0 && !pool.AppendCertsFromPEM(c.RootCAPEM) {
+		return nil, errors.New("tls config: no certificates in RootCAPEM")
+	}
+	return pool, nil
+}
+
+// verifyPins checks the verified chains, or only the leaf certificate when
+// verification is skipped: other certificates sent by the peer prove nothing
+// without a chain.
+func verifyPins(cs tls.ConnectionState, pins map[[sha256.Size]byte]bool) error {
+	chains := cs.VerifiedChains
+	if len(chains) == 0 && len(cs.PeerCertificates) > 0 {
+		chains = [][]*x509.Certificate{cs.PeerCertificates[:1]}
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if pins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+				return nil
+			}
+		}
+	}
+	return ErrCertificatePinMismatch
+}
+
+// SPKIPin returns the pin of cert for TLSConfig.PinnedSPKI.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// certReloader loads the client certificate again when its files change.
+// A broken update keeps the previous certificate in use.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	stamp     []byte
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.lastCheck) >= r.interval {
+		r.reload(now)
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) reload(now time.Time) error {
+	r.lastCheck = now
+	stamp, err := fileStamp(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls config: client certificate: %w", err)
+	}
+	if r.cert != nil && bytes.Equal(stamp, r.stamp) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls config: client certificate: %w", err)
+	}
+	r.cert, r.stamp = &cert, stamp
+	return nil
+}
+
+// fileStamp identifies file versions by modification time and size.
+func fileStamp(files ...string) ([]byte, error) {
+	var stamp []byte
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		stamp = fmt.Appendf(stamp, "%d:%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
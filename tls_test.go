@@ -0,0 +1,259 @@
+package httpoh
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issueClient returns PEM encoded client certificate and key.
+func (ca *testCA) issueClient(t *testing.T, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newMTLSServer answers with the client certificate common name, the TLS
+// version, the cipher suite and the server name sent by the client.
+func newMTLSServer(t *testing.T, ca *testCA) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commonName := "anonymous"
+		if len(r.TLS.PeerCertificates) > 0 {
+			commonName = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		fmt.Fprintf(w, "%s %x %x %s", commonName, r.TLS.Version, r.TLS.CipherSuite, r.TLS.ServerName)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: ca.pool}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func serverRootPEM(server *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+}
+
+func tlsGet(t *testing.T, cfg Config, url string) (string, error) {
+	httpClient, err := NewNetHTTPClient(cfg)
+	if err != nil {
+		return "", err
+	}
+	defer httpClient.CloseIdleConnections()
+	client, newError := NewClientNative(cfg, httpClient)
+	require.NoError(t, newError)
+	resp := &rawBodyResponse{}
+	err = client.PerformRequest(context.Background(), testGet(url), resp)
+	return resp.body, err
+}
+
+type rawBodyResponse struct {
+	body string
+}
+
+func (r *rawBodyResponse) ProcessResponse(netResp *http.Response) error {
+	body, err := io.ReadAll(netResp.Body)
+	r.body = string(body)
+	return err
+}
+
+func TestTLSRootCAsAndClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	server := newMTLSServer(t, ca)
+	certPEM, keyPEM := ca.issueClient(t, "client-pem")
+
+	dir := t.TempDir()
+	rootFile := filepath.Join(dir, "root.pem")
+	require.NoError(t, os.WriteFile(rootFile, serverRootPEM(server), 0o600))
+
+	for _, tc := range []struct {
+		Name      string
+		TLS       TLSConfig
+		WantBody  string
+		WantError string
+	}{
+		{
+			Name:      "unknown authority",
+			WantError: "certificate signed by unknown authority",
+		},
+		{
+			Name:     "root CA PEM",
+			TLS:      TLSConfig{RootCAPEM: serverRootPEM(server)},
+			WantBody: "anonymous ",
+		},
+		{
+			Name:     "root CA file with system roots",
+			TLS:      TLSConfig{RootCAFiles: []string{rootFile}, AppendSystemRoots: true},
+			WantBody: "anonymous ",
+		},
+		{
+			Name:     "client certificate PEM",
+			TLS:      TLSConfig{RootCAPEM: serverRootPEM(server), CertPEM: certPEM, KeyPEM: keyPEM},
+			WantBody: "client-pem ",
+		},
+		{
+			Name:     "server name",
+			TLS:      TLSConfig{RootCAPEM: serverRootPEM(server), ServerName: "example.com"},
+			WantBody: " example.com",
+		},
+		{
+			Name:      "wrong server name",
+			TLS:       TLSConfig{RootCAPEM: serverRootPEM(server), ServerName: "wrong.test"},
+			WantError: "not wrong.test",
+		},
+		{
+			Name: "version and cipher suite",
+			TLS: TLSConfig{
+				RootCAPEM:    serverRootPEM(server),
+				MaxVersion:   tls.VersionTLS12,
+				CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+			},
+			WantBody: fmt.Sprintf("anonymous 303 %x", tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256),
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			body, err := tlsGet(t, Config{TLS: tc.TLS}, server.URL)
+			if tc.WantError != "" {
+				assert.ErrorContains(t, err, tc.WantError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, body, tc.WantBody)
+		})
+	}
+}
+
+func TestTLSPinning(t *testing.T) {
+	ca := newTestCA(t)
+	server := newMTLSServer(t, ca)
+
+	_, err := tlsGet(t, Config{TLS: TLSConfig{RootCAPEM: serverRootPEM(server), PinnedSPKI: []string{SPKIPin(server.Certificate())}}}, server.URL)
+	assert.NoError(t, err)
+
+	_, err = tlsGet(t, Config{TLS: TLSConfig{RootCAPEM: serverRootPEM(server), PinnedSPKI: []string{SPKIPin(ca.cert)}}}, server.URL)
+	assert.ErrorIs(t, err, ErrCertificatePinMismatch)
+
+	// pins are checked with verification disabled too
+	_, err = tlsGet(t, Config{InsecureSkipVerify: true, TLS: TLSConfig{PinnedSPKI: []string{SPKIPin(ca.cert)}}}, server.URL)
+	assert.ErrorIs(t, err, ErrCertificatePinMismatch)
+
+	// without verified chains other certificates sent by the peer are not trusted
+	pins := map[[sha256.Size]byte]bool{sha256.Sum256(ca.cert.RawSubjectPublicKeyInfo): true}
+	unverified := tls.ConnectionState{PeerCertificates: []*x509.Certificate{server.Certificate(), ca.cert}}
+	assert.ErrorIs(t, verifyPins(unverified, pins), ErrCertificatePinMismatch)
+	assert.ErrorIs(t, verifyPins(tls.ConnectionState{}, pins), ErrCertificatePinMismatch)
+	verified := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{server.Certificate(), ca.cert}}}
+	assert.NoError(t, verifyPins(verified, pins))
+}
+
+func TestTLSClientCertificateReload(t *testing.T) {
+	ca := newTestCA(t)
+	server := newMTLSServer(t, ca)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key")
+	writeCert := func(commonName string, modTime time.Time) {
+		certPEM, keyPEM := ca.issueClient(t, commonName)
+		require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+		require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+		require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+		require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	}
+	writeCert("first", time.Now().Add(-time.Minute))
+
+	cfg := Config{TLS: TLSConfig{RootCAPEM: serverRootPEM(server), CertFile: certFile, KeyFile: keyFile}}
+	httpClient, err := NewNetHTTPClient(cfg)
+	require.NoError(t, err)
+	client, newError := NewClientNative(cfg, httpClient)
+	require.NoError(t, newError)
+	get := func() string {
+		httpClient.CloseIdleConnections()
+		resp := &rawBodyResponse{}
+		require.NoError(t, client.PerformRequest(context.Background(), testGet(server.URL), resp))
+		return resp.body
+	}
+
+	assert.Contains(t, get(), "first ")
+	writeCert("second", time.Now())
+	assert.Contains(t, get(), "second ")
+
+	// a broken update keeps the last good certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("WTF"), 0o600))
+	assert.Contains(t, get(), "second ")
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		Name      string
+		TLS       TLSConfig
+		WantError string
+	}{
+		{Name: "versions", TLS: TLSConfig{MinVersion: tls.VersionTLS13, MaxVersion: tls.VersionTLS12}, WantError: "below min version"},
+		{Name: "key file only", TLS: TLSConfig{KeyFile: "client.key"}, WantError: "both CertFile and KeyFile"},
+		{Name: "missing cert file", TLS: TLSConfig{CertFile: "missing.crt", KeyFile: "missing.key"}, WantError: "no such file"},
+		{Name: "bad PEM", TLS: TLSConfig{CertPEM: []byte("WTF"), KeyPEM: []byte("WTF")}, WantError: "client certificate"},
+		{Name: "bad root PEM", TLS: TLSConfig{RootCAPEM: []byte("WTF")}, WantError: "no certificates in RootCAPEM"},
+		{Name: "bad pin", TLS: TLSConfig{PinnedSPKI: []string{"AAAA"}}, WantError: "invalid SPKI pin"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := NewNetHTTPClient(Config{TLS: tc.TLS})
+			assert.ErrorContains(t, err, tc.WantError)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package httpoh
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Tracer starts a span for every ClientNative.PerformRequest call and injects
+// trace context headers (W3C traceparent, tracestate) into the outgoing
+// request. It is shaped after OpenTelemetry so adapters stay thin, the tracing
+// subpackage has a dependency-free implementation.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+	Inject(ctx context.Context, header http.Header)
+}
+
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span attribute keys, named after OpenTelemetry HTTP client semantic conventions.
+const (
+	AttrHTTPRequestMethod      = "http.request.method"
+	AttrHTTPRequestResendCount = "http.request.resend_count"
+	AttrHTTPResponseStatusCode = "http.response.status_code"
+	AttrHTTPResponseBodySize   = "http.response.body.size"
+	AttrURLFull                = "url.full"
+	AttrURLTemplate            = "url.template"
+	AttrServerAddress          = "server.address"
+)
+
+// redactURL returns u without credentials and fragment, and with query
+// parameter values replaced: they often carry tokens and signatures.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.Fragment, redacted.RawFragment = "", ""
+	if redacted.RawQuery != "" {
+		query := redacted.Query()
+		for _, values := range query {
+			for i := range values {
+				values[i] = "REDACTED"
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// requestTrace is the span of a single PerformRequest call.
+type requestTrace struct {
+	tracer Tracer
+	span   Span
+}
+
+func startRequestTrace(ctx context.Context, tracer Tracer, req Request) (context.Context, *requestTrace) {
+	method := req.Method()
+	spanName := method
+	attrs := []Attribute{{Key: AttrHTTPRequestMethod, Value: method}}
+	if u, err := url.Parse(req.URL()); err == nil {
+		attrs = append(attrs,
+			Attribute{Key: AttrURLFull, Value: redactURL(u)},
+			Attribute{Key: AttrServerAddress, Value: u.Hostname()},
+		)
+	}
+	if tReq, implements := req.(RequestWithURLTemplate); implements {
+		template := tReq.URLTemplate()
+		spanName = method + " " + template
+		attrs = append(attrs, Attribute{Key: AttrURLTemplate, Value: template})
+	}
+	if attempt := attemptFromContext(ctx); attempt > 1 {
+		attrs = append(attrs, Attribute{Key: AttrHTTPRequestResendCount, Value: attempt - 1})
+	}
+
+	ctx, span := tracer.Start(ctx, spanName)
+	span.SetAttributes(attrs...)
+	return ctx, &requestTrace{tracer: tracer, span: span}
+}
+
+// inject adds trace context headers unless the request already set them.
+func (t *requestTrace) inject(ctx context.Context, netReq *http.Request) {
+	header := make(http.Header)
+	t.tracer.Inject(ctx, header)
+	for name, values := range header {
+		if netReq.Header.Get(name) == "" && netReq.Header[strings.ToLower(name)] == nil {
+			netReq.Header[name] = values
+		}
+	}
+}
+
+func (t *requestTrace) response(netResp *http.Response) {
+	t.span.SetAttributes(Attribute{Key: AttrHTTPResponseStatusCode, Value: netResp.StatusCode})
+}
+
+func (t *requestTrace) end(bodySize int64, err error) {
+	if bodySize >= 0 {
+		t.span.SetAttributes(Attribute{Key: AttrHTTPResponseBodySize, Value: bodySize})
+	}
+	if err != nil {
+		t.span.RecordError(err)
+	}
+	t.span.End()
+}
@@ -0,0 +1,142 @@
+// Package tracing is a dependency-free httpoh.Tracer producing W3C Trace
+// Context compatible spans and handing finished ones to an Exporter.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mxpaul/httpoh"
+)
+
+// SpanData is a finished span.
+type SpanData struct {
+	Name         string
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]any
+	Errors       []error
+}
+
+type Exporter interface {
+	ExportSpan(span SpanData)
+}
+
+// InMemoryExporter keeps finished spans, it is meant for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// Tracer starts spans as children of the span context found in ctx, or as
+// roots of new sampled traces. Now is time.Now when nil.
+type Tracer struct {
+	Exporter Exporter
+	Now      func() time.Time
+}
+
+var _ httpoh.Tracer = (*Tracer)(nil)
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{Exporter: exporter, Now: time.Now}
+}
+
+func (t *Tracer) Start(ctx context.Context, spanName string) (context.Context, httpoh.Span) {
+	s := &span{
+		tracer: t,
+		data: SpanData{
+			Name:       spanName,
+			Start:      t.now(),
+			Attributes: make(map[string]any),
+		},
+	}
+
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		s.data.SpanContext = parent
+		s.data.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(s.data.SpanContext.TraceID[:])
+		s.data.SpanContext.Sampled = true
+	}
+	rand.Read(s.data.SpanContext.SpanID[:])
+
+	return ContextWithSpanContext(ctx, s.data.SpanContext), s
+}
+
+func (t *Tracer) now() time.Time {
+	if t.Now == nil {
+		return time.Now()
+	}
+	return t.Now()
+}
+
+func (t *Tracer) Inject(ctx context.Context, header http.Header) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		return
+	}
+	header.Set("Traceparent", sc.TraceParent())
+	if sc.TraceState != "" {
+		header.Set("Tracestate", sc.TraceState)
+	}
+}
+
+type span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (s *span) SetAttributes(attrs ...httpoh.Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *span) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Errors = append(s.data.Errors, err)
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.Exporter != nil {
+		s.tracer.Exporter.ExportSpan(data)
+	}
+}
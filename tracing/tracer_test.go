@@ -0,0 +1,249 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpaul/httpoh"
+)
+
+func TestTracerPerformRequest(t *testing.T) {
+	parent, parseError := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, parseError)
+	parent.TraceState = "vendor=value"
+
+	for _, tc := range []struct {
+		Name              string
+		Context           context.Context
+		RequestHeaders    http.Header
+		URLTemplate       string
+		ServerStatus      int
+		ResponseError     error
+		WantSpanName      string
+		WantTraceParent   func(span SpanData) string
+		WantTraceState    string
+		WantAttributes    map[string]any
+		WantErrorsInSpans int
+	}{
+		{
+			Name:         "new trace",
+			Context:      context.Background(),
+			ServerStatus: http.StatusOK,
+			WantSpanName: "GET",
+			WantTraceParent: func(span SpanData) string {
+				return span.SpanContext.TraceParent()
+			},
+			WantAttributes: map[string]any{
+				httpoh.AttrHTTPRequestMethod:      http.MethodGet,
+				httpoh.AttrHTTPResponseStatusCode: http.StatusOK,
+				httpoh.AttrHTTPResponseBodySize:   int64(len("response body")),
+			},
+		},
+		{
+			Name:         "child of remote parent",
+			Context:      ContextWithSpanContext(context.Background(), parent),
+			URLTemplate:  "/users/{id}",
+			ServerStatus: http.StatusNotFound,
+			WantSpanName: "GET /users/{id}",
+			WantTraceParent: func(span SpanData) string {
+				return "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext.SpanID.String() + "-01"
+			},
+			WantTraceState: "vendor=value",
+			WantAttributes: map[string]any{
+				httpoh.AttrURLTemplate:            "/users/{id}",
+				httpoh.AttrHTTPResponseStatusCode: http.StatusNotFound,
+			},
+		},
+		{
+			Name:           "request headers win",
+			Context:        context.Background(),
+			RequestHeaders: http.Header{"traceparent": []string{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}},
+			ServerStatus:   http.StatusOK,
+			WantSpanName:   "GET",
+			WantTraceParent: func(span SpanData) string {
+				return "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+			},
+		},
+		{
+			Name:              "response error recorded",
+			Context:           context.Background(),
+			ServerStatus:      http.StatusOK,
+			ResponseError:     errors.New("WTF"),
+			WantSpanName:      "GET",
+			WantErrorsInSpans: 1,
+			WantTraceParent: func(span SpanData) string {
+				return span.SpanContext.TraceParent()
+			},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			var gotTraceParent, gotTraceState string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotTraceParent = r.Header.Get("Traceparent")
+				gotTraceState = r.Header.Get("Tracestate")
+				w.WriteHeader(tc.ServerStatus)
+				w.Write([]byte("response body"))
+			}))
+			defer server.Close()
+
+			exporter := &InMemoryExporter{}
+			client, newError := httpoh.NewClientNative(httpoh.Config{}, server.Client())
+			require.NoError(t, newError)
+			client.Tracer = NewTracer(exporter)
+
+			var req httpoh.Request
+			if tc.URLTemplate != "" {
+				tReq := httpoh.NewMockRequestWithURLTemplate(t)
+				tReq.EXPECT().URL().Return(server.URL + "/users/1")
+				tReq.EXPECT().Method().Return(http.MethodGet)
+				tReq.EXPECT().URLTemplate().Return(tc.URLTemplate)
+				req = tReq
+			} else {
+				hReq := httpoh.NewMockRequestWithHeaders(t)
+				hReq.EXPECT().URL().Return(server.URL)
+				hReq.EXPECT().Method().Return(http.MethodGet)
+				hReq.EXPECT().Headers().Return(tc.RequestHeaders)
+				req = hReq
+			}
+
+			resp := httpoh.NewMockResponse(t)
+			resp.EXPECT().ProcessResponse(mock.Anything).RunAndReturn(func(r *http.Response) error {
+				io.Copy(io.Discard, r.Body)
+				return tc.ResponseError
+			})
+
+			gotError := client.PerformRequest(tc.Context, req, resp)
+			assert.Equal(t, tc.ResponseError, gotError)
+
+			spans := exporter.Spans()
+			require.Len(t, spans, 1)
+			span := spans[0]
+			assert.Equal(t, tc.WantSpanName, span.Name)
+			assert.Equal(t, tc.WantTraceParent(span), gotTraceParent)
+			assert.Equal(t, tc.WantTraceState, gotTraceState)
+			assert.Len(t, span.Errors, tc.WantErrorsInSpans)
+			assert.False(t, span.End.Before(span.Start))
+			for key, value := range tc.WantAttributes {
+				assert.Equal(t, value, span.Attributes[key], key)
+			}
+		})
+	}
+}
+
+func TestTracerRedactsURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the zero value Tracer reads the time with time.Now
+	exporter := &InMemoryExporter{}
+	client, newError := httpoh.NewClientNative(httpoh.Config{}, server.Client())
+	require.NoError(t, newError)
+	client.Tracer = &Tracer{Exporter: exporter}
+
+	url := strings.Replace(server.URL, "http://", "http://user:password@", 1) + "/path?token=secret&sig=abc&sig=def#fragment"
+	req := httpoh.NewMockRequest(t)
+	req.EXPECT().URL().Return(url)
+	req.EXPECT().Method().Return(http.MethodGet)
+	resp := httpoh.NewMockResponse(t)
+	resp.EXPECT().ProcessResponse(mock.Anything).Return(nil)
+	require.NoError(t, client.PerformRequest(context.Background(), req, resp))
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, server.URL+"/path?sig=REDACTED&sig=REDACTED&token=REDACTED", spans[0].Attributes[httpoh.AttrURLFull])
+	assert.False(t, spans[0].Start.IsZero())
+	assert.False(t, spans[0].End.Before(spans[0].Start))
+}
+
+func TestTracerRetryAttributes(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	exporter := &InMemoryExporter{}
+	native, newError := httpoh.NewClientNative(httpoh.Config{}, server.Client())
+	require.NoError(t, newError)
+	native.Tracer = NewTracer(exporter)
+	client, newError := httpoh.NewRetryClient(httpoh.RetryConfig{Backoff: httpoh.ExponentialBackoff{Base: time.Millisecond}}, native)
+	require.NoError(t, newError)
+
+	req := httpoh.NewMockRequest(t)
+	req.EXPECT().URL().Return(server.URL)
+	req.EXPECT().Method().Return(http.MethodGet)
+	resp := httpoh.NewMockResponse(t)
+	resp.EXPECT().ProcessResponse(mock.Anything).Return(nil).Once()
+
+	require.NoError(t, client.PerformRequest(context.Background(), req, resp))
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 3)
+	for i, span := range spans {
+		resendCount, hasResendCount := span.Attributes[httpoh.AttrHTTPRequestResendCount]
+		if i == 0 {
+			assert.False(t, hasResendCount)
+		} else {
+			assert.Equal(t, i, resendCount)
+		}
+	}
+	assert.Len(t, spans[0].Errors, 1)
+	assert.Empty(t, spans[2].Errors)
+}
+
+func TestParseTraceParent(t *testing.T) {
+	for _, tc := range []struct {
+		Value       string
+		WantValid   bool
+		WantSampled bool
+	}{
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", WantValid: true, WantSampled: true},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", WantValid: true},
+		{Value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", WantValid: true, WantSampled: true},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{Value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{Value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{Value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01"},
+		{Value: ""},
+	} {
+		sc, err := ParseTraceParent(tc.Value)
+		if !tc.WantValid {
+			assert.ErrorIs(t, err, ErrInvalidTraceParent, tc.Value)
+			continue
+		}
+		if assert.NoError(t, err, tc.Value) {
+			assert.Equal(t, tc.WantSampled, sc.Sampled, tc.Value)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	sc, ok := Extract(http.Header{
+		"Traceparent": []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		"Tracestate":  []string{"a=1", "b=2"},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, "a=1,b=2", sc.TraceState)
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+
+	_, ok = Extract(http.Header{})
+	assert.False(t, ok)
+}
@@ -0,0 +1,271 @@
+// Package vcr records HTTP interactions to cassette files and replays them,
+// so tests of code using httpoh clients run without the real servers.
+//
+// A Recorder is an http.RoundTripper: set it as the Transport of the
+// *http.Client passed to httpoh.NewClientNative.
+package vcr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+var ErrNoInteraction = errors.New("vcr: no recorded interaction matches the request")
+
+type Mode int
+
+const (
+	// ModeReplay answers requests from the cassette only and fails requests
+	// matching no recorded interaction.
+	ModeReplay Mode = iota
+	// ModeRecord sends all requests and records them to a new cassette.
+	ModeRecord
+	// ModeReplayOrRecord replays matching interactions and records the others
+	// to the cassette, which is created when missing.
+	ModeReplayOrRecord
+)
+
+// Redacted replaces values of redacted headers in cassettes.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactHeaders are redacted when Config.RedactHeaders is nil.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Amz-Security-Token"}
+
+// Matcher tells if a request, with its body read, matches a recorded one.
+type Matcher func(r *http.Request, body []byte, recorded Request) bool
+
+func MatchMethod(r *http.Request, _ []byte, recorded Request) bool {
+	return r.Method == recorded.Method
+}
+
+func MatchURL(r *http.Request, _ []byte, recorded Request) bool {
+	return r.URL.String() == recorded.URL
+}
+
+func MatchBody(_ *http.Request, body []byte, recorded Request) bool {
+	return bytes.Equal(body, recorded.Body)
+}
+
+// MatchHeaders compares values of the named headers. Redacted headers never
+// match.
+func MatchHeaders(names ...string) Matcher {
+	return func(r *http.Request, _ []byte, recorded Request) bool {
+		for _, name := range names {
+			if strings.Join(r.Header.Values(name), ",") != strings.Join(recorded.Header.Values(name), ",") {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// DefaultMatchers are used when Config.Matchers is nil.
+var DefaultMatchers = []Matcher{MatchMethod, MatchURL, MatchBody}
+
+// Config of a Recorder. Path is the cassette file. Transport sends requests
+// that are recorded, http.DefaultTransport by default. Each recorded
+// interaction is replayed once, in recording order, unless AllowRepeats is
+// set.
+type Config struct {
+	Mode          Mode
+	Path          string
+	Transport     http.RoundTripper
+	Matchers      []Matcher
+	RedactHeaders []string
+	AllowRepeats  bool
+}
+
+type Recorder struct {
+	mode          Mode
+	path          string
+	transport     http.RoundTripper
+	matchers      []Matcher
+	redactHeaders []string
+	allowRepeats  bool
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+var _ http.RoundTripper = (*Recorder)(nil)
+
+func NewRecorder(cfg Config) (*Recorder, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("vcr: cassette path is empty")
+	}
+	r := &Recorder{
+		mode:          cfg.Mode,
+		path:          cfg.Path,
+		transport:     cfg.Transport,
+		matchers:      cfg.Matchers,
+		redactHeaders: cfg.RedactHeaders,
+		allowRepeats:  cfg.AllowRepeats,
+		cassette:      &Cassette{},
+	}
+	if r.transport == nil {
+		r.transport = http.DefaultTransport
+	}
+	if r.matchers == nil {
+		r.matchers = DefaultMatchers
+	}
+	if r.redactHeaders == nil {
+		r.redactHeaders = DefaultRedactHeaders
+	}
+
+	switch cfg.Mode {
+	case ModeRecord:
+	case ModeReplay, ModeReplayOrRecord:
+		cassette, err := LoadCassette(cfg.Path)
+		if cfg.Mode == ModeReplayOrRecord && errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = cassette
+		r.used = make([]bool, len(cassette.Interactions))
+	default:
+		return nil, fmt.Errorf("vcr: invalid mode %d", cfg.Mode)
+	}
+	return r, nil
+}
+
+// Cassette returns a copy of the interactions recorded or loaded so far.
+func (r *Recorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Cassette{Interactions: append([]Interaction(nil), r.cassette.Interactions...)}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode != ModeRecord {
+		if interaction, ok := r.match(req, body); ok {
+			return interaction.Response.httpResponse(req), nil
+		}
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.Redacted())
+		}
+	}
+	return r.record(req, body)
+}
+
+func (r *Recorder) match(req *http.Request, body []byte) (Interaction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] && !r.allowRepeats {
+			continue
+		}
+		if r.matches(req, body, interaction.Request) {
+			r.used[i] = true
+			return interaction, true
+		}
+	}
+	return Interaction{}, false
+}
+
+func (r *Recorder) matches(req *http.Request, body []byte, recorded Request) bool {
+	for _, match := range r.matchers {
+		if !match(req, body, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: r.redact(req.Header),
+			Body:   body,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     r.redact(resp.Header),
+			Body:       respBody,
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	// recorded interactions are not replayed in the same run
+	r.used = append(r.used, true)
+	if err := r.cassette.Save(r.path); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *Recorder) redact(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range r.redactHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			header.Del(name)
+			for range values {
+				header.Add(name, Redacted)
+			}
+		}
+	}
+	return header
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("vcr: read request body: %w", err)
+	}
+	return body, nil
+}
+
+func (r Response) httpResponse(req *http.Request) *http.Response {
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
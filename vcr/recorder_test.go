@@ -0,0 +1,229 @@
+package vcr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mxpaul/httpoh"
+)
+
+type testRequest struct {
+	method string
+	url    string
+	body   string
+	header http.Header
+}
+
+func (r *testRequest) Method() string       { return r.method }
+func (r *testRequest) URL() string          { return r.url }
+func (r *testRequest) Headers() http.Header { return r.header }
+func (r *testRequest) Body() io.Reader      { return strings.NewReader(r.body) }
+
+type testResponse struct {
+	code   int
+	cookie string
+	body   string
+}
+
+func (r *testResponse) ProcessResponse(netResp *http.Response) error {
+	r.code = netResp.StatusCode
+	r.cookie = netResp.Header.Get("Set-Cookie")
+	body, err := io.ReadAll(netResp.Body)
+	r.body = string(body)
+	return err
+}
+
+func newClient(t *testing.T, recorder *Recorder) *httpoh.ClientNative {
+	client, err := httpoh.NewClientNative(httpoh.Config{UserAgent: "vcr-test"}, &http.Client{Transport: recorder})
+	require.NoError(t, err)
+	return client
+}
+
+func perform(client httpoh.Client, method, url, body string) (*testResponse, error) {
+	resp := &testResponse{}
+	req := &testRequest{method: method, url: url, body: body, header: http.Header{"Authorization": {"Bearer secret"}}}
+	err := client.PerformRequest(context.Background(), req, resp)
+	return resp, err
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cr3t"})
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, r.Method+" "+r.URL.Path+" "+string(body))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "fixtures", "cassette.json")
+
+	recorder, err := NewRecorder(Config{Mode: ModeRecord, Path: path})
+	require.NoError(t, err)
+	client := newClient(t, recorder)
+	for _, body := range []string{"one", "two"} {
+		resp, err := perform(client, http.MethodPost, server.URL+"/items", body)
+		require.NoError(t, err)
+		assert.Equal(t, &testResponse{code: http.StatusCreated, cookie: "session=s3cr3t", body: "POST /items " + body}, resp)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.NotContains(t, string(data), "s3cr3t")
+	cassette, err := LoadCassette(path)
+	require.NoError(t, err)
+	require.Len(t, cassette.Interactions, 2)
+	assert.Equal(t, Request{
+		Method: http.MethodPost,
+		URL:    server.URL + "/items",
+		Header: http.Header{"Authorization": {Redacted}, "User-Agent": {"vcr-test"}},
+		Body:   Body("one"),
+	}, cassette.Interactions[0].Request)
+	assert.Equal(t, []string{Redacted}, cassette.Interactions[0].Response.Header.Values("Set-Cookie"))
+
+	server.Close()
+	recorder, err = NewRecorder(Config{Mode: ModeReplay, Path: path})
+	require.NoError(t, err)
+	client = newClient(t, recorder)
+	for _, body := range []string{"two", "one"} {
+		resp, err := perform(client, http.MethodPost, server.URL+"/items", body)
+		require.NoError(t, err)
+		assert.Equal(t, &testResponse{code: http.StatusCreated, cookie: Redacted, body: "POST /items " + body}, resp)
+	}
+
+	_, err = perform(client, http.MethodPost, server.URL+"/items", "one")
+	assert.ErrorIs(t, err, ErrNoInteraction)
+	_, err = perform(client, http.MethodPut, server.URL+"/items", "three")
+	assert.ErrorIs(t, err, ErrNoInteraction)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestReplayMatchers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette := &Cassette{Interactions: []Interaction{
+		{
+			Request:  Request{Method: http.MethodGet, URL: "http://api.test/users?id=1", Header: http.Header{"X-Tenant": {"a"}}},
+			Response: Response{StatusCode: http.StatusOK, Body: Body("tenant a")},
+		},
+		{
+			Request:  Request{Method: http.MethodGet, URL: "http://api.test/users?id=2", Header: http.Header{"X-Tenant": {"b"}}},
+			Response: Response{StatusCode: http.StatusOK, Body: Body{0xff, 0xfe}},
+		},
+	}}
+	require.NoError(t, cassette.Save(path))
+
+	byTenant := func(r *http.Request, _ []byte, recorded Request) bool {
+		return r.URL.Path == "/users" && r.Header.Get("X-Tenant") == recorded.Header.Get("X-Tenant")
+	}
+	for _, tc := range []struct {
+		Name     string
+		Config   Config
+		Tenant   string
+		WantBody string
+		WantErr  error
+	}{
+		{Name: "default", Config: Config{}, Tenant: "b", WantErr: ErrNoInteraction},
+		{Name: "header", Config: Config{Matchers: []Matcher{MatchMethod, MatchHeaders("X-Tenant")}}, Tenant: "b", WantBody: "\xff\xfe"},
+		{Name: "custom", Config: Config{Matchers: []Matcher{byTenant}}, Tenant: "a", WantBody: "tenant a"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Config.Path = path
+			recorder, err := NewRecorder(tc.Config)
+			require.NoError(t, err)
+			req, _ := http.NewRequest(http.MethodGet, "http://api.test/users?id=3", nil)
+			req.Header.Set("X-Tenant", tc.Tenant)
+
+			resp, err := recorder.RoundTrip(req)
+			if tc.WantErr != nil {
+				assert.ErrorIs(t, err, tc.WantErr)
+				return
+			}
+			require.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tc.WantBody, string(body))
+			assert.Equal(t, "200 OK", resp.Status)
+		})
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var raw struct {
+		Interactions []struct {
+			Response struct {
+				Body json.RawMessage `json:"body"`
+			} `json:"response"`
+		} `json:"interactions"`
+	}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.JSONEq(t, `{"base64":"//4="}`, string(raw.Interactions[1].Response.Body))
+}
+
+func TestReplayOrRecord(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	for run := 0; run < 2; run++ {
+		recorder, err := NewRecorder(Config{Mode: ModeReplayOrRecord, Path: path})
+		require.NoError(t, err)
+		client := newClient(t, recorder)
+		for _, p := range []string{"/a", "/b", "/a"} {
+			resp, err := perform(client, http.MethodGet, server.URL+p, "")
+			require.NoError(t, err)
+			assert.Equal(t, p, resp.body)
+		}
+	}
+	assert.Equal(t, int32(3), calls.Load())
+	cassette, err := LoadCassette(path)
+	require.NoError(t, err)
+	assert.Len(t, cassette.Interactions, 3)
+}
+
+func TestNewRecorderErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := filepath.Join(dir, "broken.json")
+	require.NoError(t, os.WriteFile(broken, []byte("{"), 0o644))
+
+	for _, tc := range []struct {
+		Config    Config
+		WantError string
+	}{
+		{Config: Config{}, WantError: "cassette path is empty"},
+		{Config: Config{Path: filepath.Join(dir, "missing.json")}, WantError: "no such file"},
+		{Config: Config{Path: broken}, WantError: "broken.json"},
+		{Config: Config{Path: broken, Mode: 9}, WantError: "invalid mode 9"},
+	} {
+		_, err := NewRecorder(tc.Config)
+		assert.ErrorContains(t, err, tc.WantError)
+	}
+
+	recorder, err := NewRecorder(Config{Mode: ModeRecord, Path: filepath.Join(dir, "cassette.json"), Transport: failingTransport{}})
+	require.NoError(t, err)
+	_, err = perform(newClient(t, recorder), http.MethodGet, "http://api.test/", "")
+	assert.ErrorIs(t, err, errTransport)
+	assert.Empty(t, recorder.Cassette().Interactions)
+}
+
+var errTransport = errors.New("transport failed")
+
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(*http.Request) (*http.Response, error) { return nil, errTransport }